@@ -0,0 +1,66 @@
+package archive
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// Archiver keeps a copy of the rows of every chunk before they are deleted.
+// Rows passed to Archive are not durable until Commit returns, and they are discarded by Rollback.
+type Archiver interface {
+	Archive(columns []*Column, rows [][]any) error
+	Commit() error
+	Rollback() error
+	Close() error
+}
+
+type Column struct {
+	Name string
+	// Binary columns are hex encoded in csv and json
+	Binary bool
+}
+
+// binaryTypes are DatabaseTypeName of mysql driver whose value may not be valid utf8
+var binaryTypes = []string{"BLOB", "BINARY", "BIT", "GEOMETRY"}
+
+// ScanRows reads all rows, every value is nil for NULL or []byte
+func ScanRows(rows *sql.Rows) ([]*Column, [][]any, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	columns := make([]*Column, len(types))
+	for i, tp := range types {
+		columns[i] = &Column{Name: tp.Name()}
+		for _, b := range binaryTypes {
+			if strings.Contains(tp.DatabaseTypeName(), b) {
+				columns[i].Binary = true
+				break
+			}
+		}
+	}
+
+	data := make([][]any, 0)
+	for rows.Next() {
+		scanArgs := make([]any, len(columns))
+		for i := range scanArgs {
+			scanArgs[i] = &sql.RawBytes{}
+		}
+		if err = rows.Scan(scanArgs...); err != nil {
+			return nil, nil, err
+		}
+
+		row := make([]any, len(columns))
+		for i, arg := range scanArgs {
+			raw := *arg.(*sql.RawBytes)
+			if raw == nil {
+				continue
+			}
+			// RawBytes is reused by the next Scan
+			row[i] = append([]byte{}, raw...)
+		}
+		data = append(data, row)
+	}
+	return columns, data, rows.Err()
+}
@@ -0,0 +1,63 @@
+package archive
+
+import (
+	"database/sql"
+
+	"go-oak-chunk/v2/vars"
+)
+
+// DestArchiver copies rows into the dest table with `REPLACE INTO`, in its own txn which is committed before the
+// source txn. If source txn fails after that, the rows are replaced again when job continues.
+// Values are quoted by backslash, NO_BACKSLASH_ESCAPES is removed from sql_mode of the txn.
+type DestArchiver struct {
+	Client *sql.DB
+	Table  string
+
+	tx *sql.Tx
+}
+
+func NewDestArchiver(client *sql.DB, table string) *DestArchiver {
+	return &DestArchiver{Client: client, Table: table}
+}
+
+func (d *DestArchiver) Archive(columns []*Column, rows [][]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if d.tx == nil {
+		tx, err := d.Client.Begin()
+		if err != nil {
+			return err
+		}
+		d.tx = tx
+		if _, err = d.tx.Exec(vars.BackslashEscapesSQL); err != nil {
+			return err
+		}
+	}
+	_, err := d.tx.Exec(InsertStmt("REPLACE", d.Table, columns, rows))
+	return err
+}
+
+func (d *DestArchiver) Commit() error {
+	if d.tx == nil {
+		return nil
+	}
+	err := d.tx.Commit()
+	d.tx = nil
+	return err
+}
+
+func (d *DestArchiver) Rollback() error {
+	if d.tx == nil {
+		return nil
+	}
+	err := d.tx.Rollback()
+	d.tx = nil
+	return err
+}
+
+func (d *DestArchiver) Close() error {
+	_ = d.Rollback()
+	return d.Client.Close()
+}
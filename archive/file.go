@@ -0,0 +1,215 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go-oak-chunk/v2/utils"
+	"go-oak-chunk/v2/vars"
+)
+
+// csvNull is how NULL is written in csv, the same as `SELECT ... INTO OUTFILE`
+const csvNull = `\N`
+
+// FileArchiver appends rows to a local file in csv, json lines or sql insert format
+type FileArchiver struct {
+	Path   string
+	Format string
+	Table  string
+
+	file *os.File
+	buf  *bufio.Writer
+	// offset is the size of file after last Commit, Rollback truncates the file to it
+	offset int64
+	header bool
+}
+
+func NewFileArchiver(path, format, table string) (*FileArchiver, error) {
+	switch format {
+	case vars.ArchiveFormatCSV, vars.ArchiveFormatJSON, vars.ArchiveFormatSQL:
+	default:
+		return nil, fmt.Errorf("unknown archive format: %s", format)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &FileArchiver{
+		Path:   path,
+		Format: format,
+		Table:  table,
+		file:   file,
+		buf:    bufio.NewWriter(file),
+		offset: stat.Size(),
+		// file continued by resume has the csv header already
+		header: stat.Size() > 0,
+	}, nil
+}
+
+func (f *FileArchiver) Archive(columns []*Column, rows [][]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	switch f.Format {
+	case vars.ArchiveFormatCSV:
+		return f.writeCSV(columns, rows)
+	case vars.ArchiveFormatJSON:
+		return f.writeJSON(columns, rows)
+	default:
+		return f.writeSQL(columns, rows)
+	}
+}
+
+// Commit flushes and fsyncs the rows archived since last Commit
+func (f *FileArchiver) Commit() error {
+	if err := f.buf.Flush(); err != nil {
+		return err
+	}
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+
+	stat, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+	f.offset = stat.Size()
+	return nil
+}
+
+// Rollback discards the rows archived since last Commit
+func (f *FileArchiver) Rollback() error {
+	f.buf.Reset(f.file)
+	f.header = f.offset > 0
+	return f.file.Truncate(f.offset)
+}
+
+func (f *FileArchiver) Close() error {
+	return f.file.Close()
+}
+
+func (f *FileArchiver) writeCSV(columns []*Column, rows [][]any) error {
+	w := csv.NewWriter(f.buf)
+	if !f.header {
+		names := make([]string, len(columns))
+		for i, col := range columns {
+			names[i] = col.Name
+		}
+		if err := w.Write(names); err != nil {
+			return err
+		}
+		f.header = true
+	}
+
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, v := range row {
+			if v == nil {
+				record[i] = csvNull
+				continue
+			}
+			record[i] = textValue(columns[i], v.([]byte))
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// writeJSON writes one object per row, keeps the order of columns
+func (f *FileArchiver) writeJSON(columns []*Column, rows [][]any) error {
+	for _, row := range rows {
+		var line strings.Builder
+		line.WriteByte('{')
+		for i, v := range row {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			name, _ := json.Marshal(columns[i].Name)
+			line.Write(name)
+			line.WriteByte(':')
+			if v == nil {
+				line.WriteString("null")
+				continue
+			}
+			value, _ := json.Marshal(textValue(columns[i], v.([]byte)))
+			line.Write(value)
+		}
+		line.WriteString("}\n")
+
+		if _, err := io.WriteString(f.buf, line.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSQL writes one insert stmt per chunk
+func (f *FileArchiver) writeSQL(columns []*Column, rows [][]any) error {
+	_, err := io.WriteString(f.buf, InsertStmt("INSERT", f.Table, columns, rows)+";\n")
+	return err
+}
+
+// InsertStmt returns the insert or replace stmt of rows with all values inlined
+func InsertStmt(verb, table string, columns []*Column, rows [][]any) string {
+	return insertStmt(verb, fmt.Sprintf("`%s`", table), columns, rows)
+}
+
+func insertStmt(verb, table string, columns []*Column, rows [][]any) string {
+	var stmt strings.Builder
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = fmt.Sprintf("`%s`", col.Name)
+	}
+	stmt.WriteString(fmt.Sprintf("%s INTO %s (%s) VALUES ", verb, table, strings.Join(names, ",")))
+
+	for n, row := range rows {
+		if n > 0 {
+			stmt.WriteByte(',')
+		}
+		stmt.WriteByte('(')
+		for i, v := range row {
+			if i > 0 {
+				stmt.WriteByte(',')
+			}
+			stmt.WriteString(sqlValue(columns[i], v))
+		}
+		stmt.WriteByte(')')
+	}
+	return stmt.String()
+}
+
+// sqlValue returns the literal of value, binary value is written in hex
+func sqlValue(col *Column, v any) string {
+	switch {
+	case v == nil:
+		return "NULL"
+	case col.Binary:
+		return "X'" + hex.EncodeToString(v.([]byte)) + "'"
+	default:
+		return utils.QuoteValue(v, false)
+	}
+}
+
+func textValue(col *Column, v []byte) string {
+	if col.Binary {
+		return hex.EncodeToString(v)
+	}
+	return string(v)
+}
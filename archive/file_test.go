@@ -0,0 +1,55 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-oak-chunk/v2/vars"
+)
+
+func TestFileArchiver(t *testing.T) {
+	columns := []*Column{{Name: "id"}, {Name: "name"}, {Name: "data", Binary: true}}
+	rows := [][]any{
+		{[]byte("1"), []byte("a'b"), []byte{0xff, 0x00}},
+		{[]byte("2"), nil, nil},
+	}
+
+	cases := map[string]string{
+		vars.ArchiveFormatCSV:  "id,name,data\n1,a'b,ff00\n2,\\N,\\N\n",
+		vars.ArchiveFormatJSON: "{\"id\":\"1\",\"name\":\"a'b\",\"data\":\"ff00\"}\n{\"id\":\"2\",\"name\":null,\"data\":null}\n",
+		vars.ArchiveFormatSQL:  "INSERT INTO `t1` (`id`,`name`,`data`) VALUES ('1','a\\'b',X'ff00'),('2',NULL,NULL);\n",
+	}
+	for format, expected := range cases {
+		path := filepath.Join(t.TempDir(), "archive."+format)
+		a, err := NewFileArchiver(path, format, "t1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// rows of rollback txn are discarded
+		if err = a.Archive(columns, rows); err != nil {
+			t.Fatal(err)
+		}
+		if err = a.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		if err = a.Archive(columns, rows); err != nil {
+			t.Fatal(err)
+		}
+		if err = a.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if err = a.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != expected {
+			t.Fatalf("%s got:\n%s\nexpected:\n%s", format, content, expected)
+		}
+	}
+}
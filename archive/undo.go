@@ -0,0 +1,193 @@
+package archive
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"go-oak-chunk/v2/vars"
+)
+
+// UndoChunkPrefix starts every chunk of undo log, followed by the number of rows of the chunk
+const UndoChunkPrefix = "-- chunk rows="
+
+// UndoLog appends the reverse stmts of every chunk to a local file, which are replayed by `goc undo`.
+// Deleted rows are restored by `REPLACE INTO`, updated rows are restored by `UPDATE ... WHERE <key>`
+// with the before-image of the SET columns. Every stmt is in one line, table is qualified by database.
+type UndoLog struct {
+	*FileArchiver
+	Database string
+	SqlType  string
+	// Keys locate the updated rows, they are not changed by the update
+	Keys []string
+}
+
+func NewUndoLog(path, database, table, sqlType string, keys []string) (*UndoLog, error) {
+	f, err := NewFileArchiver(path, vars.ArchiveFormatSQL, table)
+	if err != nil {
+		return nil, err
+	}
+	return &UndoLog{FileArchiver: f, Database: database, SqlType: sqlType, Keys: keys}, nil
+}
+
+func (u *UndoLog) Archive(columns []*Column, rows [][]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	if !u.header {
+		fmt.Fprintf(&b, "-- undo log of %s on %s, replay by: goc undo --file %s\n", u.SqlType, u.table(), u.Path)
+		u.header = true
+	}
+	fmt.Fprintf(&b, "%s%d\n", UndoChunkPrefix, len(rows))
+
+	if u.SqlType == "Delete" {
+		b.WriteString(insertStmt("REPLACE", u.table(), columns, rows) + ";\n")
+	} else {
+		stmts, err := u.updateStmts(columns, rows)
+		if err != nil {
+			return err
+		}
+		for _, stmt := range stmts {
+			b.WriteString(stmt + ";\n")
+		}
+	}
+
+	_, err := io.WriteString(u.buf, b.String())
+	return err
+}
+
+// updateStmts sets the columns back to the before-image, one stmt per row
+func (u *UndoLog) updateStmts(columns []*Column, rows [][]any) ([]string, error) {
+	isKey := make([]bool, len(columns))
+	keys := 0
+	for i, col := range columns {
+		for _, key := range u.Keys {
+			if strings.EqualFold(col.Name, key) {
+				isKey[i] = true
+				keys++
+				break
+			}
+		}
+	}
+	if keys != len(u.Keys) || keys == len(columns) {
+		return nil, errors.New("before-image must contain all the key columns and the SET columns")
+	}
+
+	stmts := make([]string, 0, len(rows))
+	for _, row := range rows {
+		sets := make([]string, 0, len(columns)-keys)
+		conds := make([]string, 0, keys)
+		for i, v := range row {
+			if !isKey[i] {
+				sets = append(sets, fmt.Sprintf("`%s`=%s", columns[i].Name, sqlValue(columns[i], v)))
+				continue
+			}
+			if v == nil {
+				conds = append(conds, fmt.Sprintf("`%s` IS NULL", columns[i].Name))
+			} else {
+				conds = append(conds, fmt.Sprintf("`%s`=%s", columns[i].Name, sqlValue(columns[i], v)))
+			}
+		}
+		stmts = append(stmts, fmt.Sprintf("UPDATE %s SET %s WHERE %s", u.table(), strings.Join(sets, ","), strings.Join(conds, " AND ")))
+	}
+	return stmts, nil
+}
+
+func (u *UndoLog) table() string {
+	return fmt.Sprintf("`%s`.`%s`", u.Database, u.Table)
+}
+
+// UndoChunk is the rows and reverse stmts of a chunk
+type UndoChunk struct {
+	Rows  int64
+	Stmts []string
+}
+
+// UndoReader reads the chunks of undo log from the last one to the first one,
+// so that the latest change is undone first
+type UndoReader struct {
+	file    *os.File
+	offsets []int64
+	rows    []int64
+	size    int64
+	next    int
+}
+
+// OpenUndoLog finds the offset of every chunk in undo log
+func OpenUndoLog(path string) (*UndoReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &UndoReader{file: file}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if strings.HasPrefix(line, UndoChunkPrefix) {
+			rows, errParse := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, UndoChunkPrefix)), 10, 64)
+			if errParse != nil {
+				_ = file.Close()
+				return nil, fmt.Errorf("bad chunk line at offset %d of undo log: %s", r.size, strings.TrimSpace(line))
+			}
+			r.offsets = append(r.offsets, r.size)
+			r.rows = append(r.rows, rows)
+		}
+		r.size += int64(len(line))
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+	}
+	r.next = len(r.offsets) - 1
+	return r, nil
+}
+
+// Chunks returns the number of chunks in undo log
+func (r *UndoReader) Chunks() int {
+	return len(r.offsets)
+}
+
+// Next returns the previous chunk of the last one returned, or io.EOF after the first chunk
+func (r *UndoReader) Next() (*UndoChunk, error) {
+	if r.next < 0 {
+		return nil, io.EOF
+	}
+	i := r.next
+	r.next--
+
+	end := r.size
+	if i+1 < len(r.offsets) {
+		end = r.offsets[i+1]
+	}
+	reader := bufio.NewReader(io.NewSectionReader(r.file, r.offsets[i], end-r.offsets[i]))
+
+	chunk := &UndoChunk{Rows: r.rows[i]}
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			chunk.Stmts = append(chunk.Stmts, strings.TrimSuffix(line, ";"))
+		}
+		if err == io.EOF {
+			return chunk, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *UndoReader) Close() error {
+	return r.file.Close()
+}
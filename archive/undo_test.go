@@ -0,0 +1,86 @@
+package archive
+
+import (
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUndoLog(t *testing.T) {
+	columns := []*Column{{Name: "id"}, {Name: "name"}}
+	cases := []struct {
+		sqlType  string
+		keys     []string
+		expected [][]string
+	}{
+		{
+			sqlType: "Delete",
+			keys:    []string{"id"},
+			expected: [][]string{
+				{"REPLACE INTO `db`.`t1` (`id`,`name`) VALUES ('3','c')"},
+				{"REPLACE INTO `db`.`t1` (`id`,`name`) VALUES ('1','a\\'b'),('2',NULL)"},
+			},
+		},
+		{
+			sqlType: "Update",
+			keys:    []string{"ID"},
+			expected: [][]string{
+				{"UPDATE `db`.`t1` SET `name`='c' WHERE `id`='3'"},
+				{"UPDATE `db`.`t1` SET `name`='a\\'b' WHERE `id`='1'", "UPDATE `db`.`t1` SET `name`=NULL WHERE `id`='2'"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		path := filepath.Join(t.TempDir(), "undo.sql")
+		u, err := NewUndoLog(path, "db", "t1", c.sqlType, c.keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks := [][][]any{
+			{{[]byte("1"), []byte("a'b")}, {[]byte("2"), nil}},
+			{{[]byte("3"), []byte("c")}},
+		}
+		for _, rows := range chunks {
+			// rows of rollback txn are discarded
+			if err = u.Archive(columns, rows); err != nil {
+				t.Fatal(err)
+			}
+			if err = u.Rollback(); err != nil {
+				t.Fatal(err)
+			}
+			if err = u.Archive(columns, rows); err != nil {
+				t.Fatal(err)
+			}
+			if err = u.Commit(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = u.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := OpenUndoLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Chunks() != 2 {
+			t.Fatalf("%s: expected 2 chunks, got %d", c.sqlType, r.Chunks())
+		}
+		// the last chunk is read first
+		for i, expected := range c.expected {
+			chunk, err := r.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chunk.Rows != int64(len(chunks[len(chunks)-1-i])) || !reflect.DeepEqual(chunk.Stmts, expected) {
+				t.Fatalf("%s: got %d rows %v", c.sqlType, chunk.Rows, chunk.Stmts)
+			}
+		}
+		if _, err = r.Next(); err != io.EOF {
+			t.Fatalf("%s: expected EOF, got %v", c.sqlType, err)
+		}
+		_ = r.Close()
+	}
+}
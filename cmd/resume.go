@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/log"
+	"go-oak-chunk/v2/mysql"
+	"go-oak-chunk/v2/task"
+	"go-oak-chunk/v2/vars"
+)
+
+var (
+	checkpointPath string
+	jobId          string
+	destPassword   string
+)
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Resume an interrupted chunk dml",
+	Long:  `Resume an interrupted chunk dml from the last committed key values of its checkpoint`,
+	Example: fmt.Sprintf("%s resume --checkpoint <checkpoint file> -p <password>\n", vars.AppName) +
+		fmt.Sprintf("%s resume --job-id <job id> -H <host> -P <port> -u <user> -p <password> -d <database>\n", vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.StreamLogger.Debug("Go-oak-chunk resume...")
+
+		cp, err := loadCheckpoint()
+		if err != nil {
+			log.StreamLogger.Error(err.Error())
+			return err
+		}
+
+		// password is never saved in checkpoint
+		config := cp.Config
+		config.Password = password
+		config.DestPassword = destPassword
+		if jobId != "" {
+			config.CheckpointTable = true
+			config.JobId = jobId
+		} else {
+			config.CheckpointFile = checkpointPath
+		}
+		config.ForceChunkingColumn = strings.Join(cp.UniqueKey, ",")
+		config.Resume = true
+		config.PreCheck()
+
+		ctx, cancel := notifyContext(nil)
+		defer cancel()
+
+		err = task.RunTask(ctx, config)
+		if errors.Is(err, context.Canceled) {
+			os.Exit(vars.ExitInterrupted)
+		} else if err != nil {
+			log.StreamLogger.Error(err.Error())
+			return err
+		}
+		return nil
+	},
+}
+
+func loadCheckpoint() (*mysql.Checkpoint, error) {
+	if checkpointPath != "" && jobId != "" {
+		return nil, errors.New("--checkpoint and --job-id are mutually exclusive")
+	}
+
+	if checkpointPath != "" {
+		return mysql.LoadCheckpoint(checkpointPath)
+	}
+
+	if jobId == "" {
+		return nil, errors.New("checkpoint must be provided via --checkpoint or --job-id")
+	}
+	if database == "" {
+		return nil, errors.New("database of _goc_jobs must be provided via -d or --database")
+	}
+
+	client, err := mysql.NewMysqlClient(&conf.Config{
+		Host:     host,
+		Port:     port,
+		User:     user,
+		Password: password,
+		Database: database,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	store := &mysql.TableCheckpointStore{
+		MysqlClient: client,
+		Database:    database,
+		JobId:       jobId,
+	}
+	return store.Load()
+}
+
+func initResume() {
+	resumeCmd.Flags().StringVar(&checkpointPath, "checkpoint", "", "checkpoint file written by `run --checkpoint-file`")
+	resumeCmd.Flags().StringVar(&jobId, "job-id", "", "job id in table _goc_jobs written by `run --checkpoint-table --job-id <job id>`")
+	resumeCmd.Flags().StringVarP(&host, "host", "H", "localhost", "MySQL host, only used with --job-id")
+	resumeCmd.Flags().IntVarP(&port, "port", "P", 3306, "TCP/IP port, only used with --job-id")
+	resumeCmd.Flags().StringVarP(&user, "user", "u", "root", "MySQL user, only used with --job-id")
+	resumeCmd.Flags().StringVarP(&database, "database", "d", "", "Database of table _goc_jobs, only used with --job-id")
+	resumeCmd.Flags().StringVarP(&password, "password", "p", "", "MySQL password")
+	resumeCmd.Flags().StringVar(&destPassword, "dest-password", "", "Password of --dest of the job, default is the same as --password")
+	rootCmd.AddCommand(resumeCmd)
+}
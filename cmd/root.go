@@ -20,6 +20,8 @@ var rootCmd = &cobra.Command{
 func initAll() {
 	initVersion()
 	initRun()
+	initResume()
+	initUndo()
 }
 
 func Execute() {
@@ -1,12 +1,15 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"runtime"
 	"runtime/pprof"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -18,6 +21,7 @@ import (
 
 var (
 	configPath string
+	jobsPath   string
 	cpuprofile string
 	memprofile string
 
@@ -36,11 +40,42 @@ var (
 	sleep         int64
 	//skipLockTables bool
 
-	database      string
-	txnSize       int64
-	debug         bool
-	noConsiderLag bool
-	maxLag        int64
+	database        string
+	txnSize         int64
+	debug           bool
+	noConsiderLag   bool
+	maxLag          int64
+	dryRun          bool
+	explainCheck    string
+	checkpointFile  string
+	checkpointTable bool
+	controlSocket   string
+	httpAddr        string
+	archiveFile     string
+	archiveFormat   string
+	dest            string
+	drivingTable    string
+
+	preCount           bool
+	assumeYes          bool
+	maxAffectedRows    int64
+	maxAffectedPercent float64
+	progressFormat     string
+	progressInterval   int64
+	reportFile         string
+	undoFile           string
+	verifyRows         bool
+	verifyRerun        bool
+	parallel           int
+	workers            int64
+	windows            []string
+	timeZone           string
+	maxLoad            string
+	criticalLoad       string
+	throttleQuery      string
+	throttleFlagFile   string
+	throttleHTTP       string
+	chunkTime          time.Duration
 )
 
 var runCmd = &cobra.Command{
@@ -51,6 +86,10 @@ var runCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		log.StreamLogger.Debug("Go-oak-chunk start...")
 
+		if jobsPath != "" {
+			return runJobs(cmd)
+		}
+
 		// parse configuration file or cmd line
 		var (
 			config *conf.Config
@@ -78,11 +117,41 @@ var runCmd = &cobra.Command{
 				IncludeSlaves: includeSlaves,
 				ExcludeSlaves: excludeSlaves,
 				//SkipLockTables: skipLockTables,
-				Database:      database,
-				Debug:         debug,
-				NoConsiderLag: noConsiderLag,
-				TxnSize:       txnSize,
-				Correct:       50,
+				Database:           database,
+				Debug:              debug,
+				DryRun:             dryRun,
+				ExplainCheck:       explainCheck,
+				CheckpointFile:     checkpointFile,
+				CheckpointTable:    checkpointTable,
+				JobId:              jobId,
+				ControlSocket:      controlSocket,
+				HTTPAddr:           httpAddr,
+				ProgressFormat:     progressFormat,
+				ProgressInterval:   progressInterval,
+				ReportFile:         reportFile,
+				ArchiveFile:        archiveFile,
+				ArchiveFormat:      archiveFormat,
+				Dest:               dest,
+				UndoFile:           undoFile,
+				Verify:             verifyRows,
+				VerifyRerun:        verifyRerun,
+				Workers:            workers,
+				Windows:            windows,
+				TimeZone:           timeZone,
+				MaxLoad:            maxLoad,
+				CriticalLoad:       criticalLoad,
+				ThrottleQuery:      throttleQuery,
+				ThrottleFlagFile:   throttleFlagFile,
+				ThrottleHTTP:       throttleHTTP,
+				ChunkTime:          chunkTime,
+				DrivingTable:       drivingTable,
+				PreCount:           preCount,
+				AssumeYes:          assumeYes,
+				MaxAffectedRows:    maxAffectedRows,
+				MaxAffectedPercent: maxAffectedPercent,
+				NoConsiderLag:      noConsiderLag,
+				TxnSize:            txnSize,
+				Correct:            50,
 			}
 			config.PreCheck()
 		}
@@ -90,25 +159,25 @@ var runCmd = &cobra.Command{
 		f := StartCpuProfile()
 		defer StopCpuProfile(f)
 
-		// finish cpu perf profiling before ctrl-C/kill/kill -15
-		ch := make(chan os.Signal, 5)
-		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
-		go func() {
-			for {
-				sig := <-ch
-				switch sig {
-				case syscall.SIGINT, syscall.SIGTERM:
-					log.StreamLogger.Debug("Terminating process, will finish cpu pprof before exit(if specified)...")
-					StopCpuProfile(f)
-					os.Exit(1)
-				default:
-				}
+		// finish cpu perf profiling and the open txn before ctrl-C/kill/kill -15
+		ctx, cancel := notifyContext(f)
+		defer cancel()
+
+		// only print the chunks, nothing will be written
+		if config.DryRun {
+			err = task.PlanTask(ctx, config)
+			if err != nil {
+				log.StreamLogger.Error(err.Error())
 			}
-		}()
+			return err
+		}
 
 		// run task
-		err = task.RunTask(config)
-		if err != nil {
+		err = task.RunTask(ctx, config)
+		if errors.Is(err, context.Canceled) {
+			StopCpuProfile(f)
+			os.Exit(vars.ExitInterrupted)
+		} else if err != nil {
 			log.StreamLogger.Error(err.Error())
 			return err
 		}
@@ -121,9 +190,12 @@ var runCmd = &cobra.Command{
 
 func initRun() {
 	runCmd.Flags().StringVarP(&configPath, "config", "c", "", "config file path")
+	runCmd.Flags().StringVarP(&jobsPath, "jobs-file", "f", "", "jobs file path, the jobs in [[jobs]] run in order with the shared settings at top level")
+	runCmd.Flags().IntVar(&parallel, "parallel", 1, "Number of jobs of --jobs-file running at the same time, overrides parallel in jobs file.\nParallel jobs share one token bucket of sleep and one slave lag checker")
 	runCmd.Flags().StringVar(&cpuprofile, "cpuprofile", "", "write cpu profile to `file`")
 	runCmd.Flags().StringVar(&memprofile, "memprofile", "", "write memory profile to `file`")
 	runCmd.Flags().Int64Var(&chunkSize, "chunk-size", 1000, "Number of rows to act on in chunks.\nZero(0) means all rows updated in one operation.\nOne(1) means update/delete one row everytime.\nThe lower the number, the shorter any locks are held, but the more operations required and the more total running time.")
+	runCmd.Flags().DurationVar(&chunkTime, "chunk-time", 0, "Adjust the rows of chunks to make every chunk take this time, ex: 0.5s.\nIt starts from --chunk-size and is kept between 1/10 and 10 times of it. 0 means fixed chunk size")
 	runCmd.Flags().StringVarP(&executeQuery, "execute", "e", "", "Query to execute, which must contain where clause")
 	runCmd.Flags().StringVar(&forceChunkingColumn, "force-chunking-column", "", "Columns to chunk by. Format: for single column keys, or column1_name,column2_name,...")
 	runCmd.Flags().StringVarP(&host, "host", "H", "localhost", "MySQL host")
@@ -134,6 +206,8 @@ func initRun() {
 	runCmd.Flags().StringVar(&excludeSlaves, "exclude-slaves", "", "which slaves should be include, include_slaves and exclude_slaves are mutually exclusive.\nex: ip or ip1,ip2,... without port")
 	//runCmd.Flags().BoolVar(&noLogBin, "no-log-bin", false, "Do not log to binary log (actions will not replicate). This may be useful if the slave already finds it hard to replicate behind master. The utility may be spawned manually on slave machines, therefore utilizing more than one CPU core on those machines, making replication process faster due to parallelism.")
 	runCmd.Flags().BoolVar(&printProgress, "print-progress", false, "Show number of affected rows during utility runtime")
+	runCmd.Flags().StringVar(&progressFormat, "progress-format", "", "Format of --print-progress: plain(one line per interval), json(one event object per line) or tui.\nDefault is tui if stdout is a terminal, otherwise plain")
+	runCmd.Flags().Int64Var(&progressInterval, "progress-interval", 3, "Number of seconds between two progress outputs")
 	runCmd.Flags().Int64Var(&sleep, "sleep", 0, "Number of seconds to sleep between chunks.")
 	runCmd.Flags().BoolVar(&noConsiderLag, "noConsiderLag", false, "If true: sleep value will not be overshoot\nfalse: if slave lag is very high, sleep will be overshoot")
 	//runCmd.Flags().BoolVar(&skipLockTables, "skip-lock-tables", false, "Do not issue a LOCK TABLES READ. May be required when using queries within --start-with or --end-with")
@@ -141,17 +215,99 @@ func initRun() {
 	runCmd.Flags().Int64Var(&txnSize, "txn-size", 1000, "Number of rows per transaction.")
 	runCmd.Flags().Int64Var(&maxLag, "max-lag", 0, "Pause chunk dml if the slave reach Threshold.")
 	runCmd.Flags().BoolVar(&debug, "debug", false, "If debug_mode is true, print debug logs")
+	runCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print chunk boundaries and the generated SQL of every chunk without writing")
+	runCmd.Flags().StringVar(&checkpointFile, "checkpoint-file", "", "Save the last committed key values and row counters to this file after every commit.\nAn interrupted job can be continued by `resume --checkpoint <file>`")
+	runCmd.Flags().BoolVar(&checkpointTable, "checkpoint-table", false, "Save the progress to table _goc_jobs of database instead of a local file, keyed by --job-id.\nThe job can be continued from any host by `resume --job-id <job id>`")
+	runCmd.Flags().StringVar(&jobId, "job-id", "", "Job id of the checkpoint table")
+	runCmd.Flags().StringVar(&controlSocket, "control-socket", "", "Unix socket to pause/resume/abort the job or change sleep, max-lag and txn-size while it's running.\nex: echo 'set sleep=2' | nc -U <socket>")
+	runCmd.Flags().StringVar(&archiveFile, "archive-file", "", "Only for delete. Copy the rows of every chunk to this file in the same txn before they are deleted")
+	runCmd.Flags().StringVar(&archiveFormat, "archive-format", "csv", "Format of --archive-file: csv, json(one object per line) or sql(insert stmt)")
+	runCmd.Flags().BoolVar(&preCount, "precount", false, "Count the rows matching the where clause by chunks before writing, and ask for confirmation unless --yes")
+	runCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Don't ask for confirmation after --precount")
+	runCmd.Flags().Int64Var(&maxAffectedRows, "max-affected-rows", 0, "Abort and rollback the open txn when rows affected exceed this value. Zero(0) means no limit")
+	runCmd.Flags().Float64Var(&maxAffectedPercent, "max-affected-percent", 0, "Abort and rollback the open txn when rows affected exceed the pre-count by this percent, requires --precount")
+	runCmd.Flags().StringVar(&drivingTable, "driving-table", "", "Only for multi-table update/delete. The table name or alias to chunk on.\nDefault is the only table to delete from, or the leftmost table of the join")
+	runCmd.Flags().StringVar(&dest, "dest", "", "Only for delete. Copy the rows of every chunk to dest table and commit them before they are deleted.\nFormat: [user[:pass]@]host[:port]/db/table, user, password and port are the same as source if omitted")
+	runCmd.Flags().StringVar(&reportFile, "report-file", "", "Write a json report of the run to this file when it returns: stmt, key range, rows, chunks, txns, retries,\nthrottled time by reason, max slave lag and chunk latency percentiles")
+	runCmd.Flags().StringVar(&undoFile, "undo-file", "", "Only for single-table update/delete. Write the before-image of every chunk as reverse stmts to this file in the same txn,\nthe change can be undone by: goc undo --file <file>")
+	runCmd.Flags().BoolVar(&verifyRows, "verify", false, "Walk the table again by chunks after writing, and report the rows still matching the where clause of delete,\nor still different from SET of update, which are usually written concurrently")
+	runCmd.Flags().BoolVar(&verifyRerun, "verify-rerun", false, "Run the chunks of residual rows found by --verify again")
+	runCmd.Flags().StringVar(&maxLoad, "max-load", "", "Pause new txns while a global status of source is over the threshold, checked every second.\nex: Threads_running=50,Threads_connected=1000")
+	runCmd.Flags().StringVar(&criticalLoad, "critical-load", "", "Finish the open txn and abort when a global status of source is over the threshold.\nex: Threads_running=200")
+	runCmd.Flags().StringVar(&throttleQuery, "throttle-query", "", "Pause new txns while this SELECT on source returns a non-zero number, checked every second")
+	runCmd.Flags().StringVar(&throttleFlagFile, "throttle-flag-file", "", "Pause new txns while this file exists")
+	runCmd.Flags().StringVar(&throttleHTTP, "throttle-http", "", "Pause new txns unless GET of this url returns 200, checked every second")
+	runCmd.Flags().StringSliceVar(&windows, "windows", nil, "Maintenance windows in which new txns are started, out of them the job waits for the next one.\nex: \"01:00-05:00,Sat 00:00-Sun 23:59\", the end is excluded")
+	runCmd.Flags().StringVar(&timeZone, "time-zone", "", "IANA time zone of --windows, ex: Asia/Shanghai. Default is the local time zone")
+	runCmd.Flags().Int64Var(&workers, "workers", 1, "Split the matching rows into N ranges of about the same rows by the integer leading key column,\nevery range is run by its own reader and writer at the same time, sharing the slave lag check")
+	runCmd.Flags().StringVar(&httpAddr, "http-addr", "", "Serve json status on /status and prometheus metrics on /metrics while it's running.\nex: 127.0.0.1:9100")
+	runCmd.Flags().StringVar(&explainCheck, "explain-check", "warn", "EXPLAIN the boundary select and the chunk stmt before running.\nwarn: print a warning if the chosen key isn't used, abort: refuse to start, off: skip")
 	rootCmd.AddCommand(runCmd)
 }
 
+// runJobs runs the jobs of jobs file in order, or --parallel of them at the same time
+func runJobs(cmd *cobra.Command) error {
+	if configPath != "" {
+		err := errors.New("--config and --jobs-file are mutually exclusive")
+		log.StreamLogger.Error(err.Error())
+		return err
+	}
+
+	jobs, err := conf.NewJobs(jobsPath)
+	if err == nil && cmd.Flags().Changed("parallel") {
+		err = jobs.SetParallel(parallel)
+	}
+	if err != nil {
+		log.StreamLogger.Error(err.Error())
+		return err
+	}
+
+	f := StartCpuProfile()
+	defer StopCpuProfile(f)
+
+	ctx, cancel := notifyContext(f)
+	defer cancel()
+
+	err = task.RunJobs(ctx, jobs)
+	if errors.Is(err, context.Canceled) {
+		StopCpuProfile(f)
+		os.Exit(vars.ExitInterrupted)
+	} else if err != nil {
+		log.StreamLogger.Error(err.Error())
+		return err
+	}
+
+	MemProfile()
+	return nil
+}
+
+// notifyContext cancels ctx on the first SIGINT/SIGTERM, so that the open txn can be finished and checkpoint saved.
+// The second signal exits immediately.
+func notifyContext(f *os.File) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan os.Signal, 5)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-ch
+		log.StreamLogger.Error("Got signal %v, finishing the open txn before exit. Send it again to exit immediately", sig)
+		cancel()
+
+		<-ch
+		log.StreamLogger.Debug("Terminating process, will finish cpu pprof before exit(if specified)...")
+		StopCpuProfile(f)
+		os.Exit(1)
+	}()
+	return ctx, cancel
+}
+
 func StartCpuProfile() *os.File {
 	if cpuprofile != "" {
 		f, err := os.Create(cpuprofile)
 		if err != nil {
-			log.StreamLogger.Fatal("could not create CPU profile: ", err)
+			log.StreamLogger.Fatal("could not create CPU profile: %v", err)
 		}
 		if err := pprof.StartCPUProfile(f); err != nil {
-			log.StreamLogger.Fatal("could not start CPU profile: ", err)
+			log.StreamLogger.Fatal("could not start CPU profile: %v", err)
 		}
 		log.StreamLogger.Info("cpu pprof start ...")
 		return f
@@ -172,12 +328,12 @@ func MemProfile() {
 	if memprofile != "" {
 		f, err := os.Create(memprofile)
 		if err != nil {
-			log.StreamLogger.Fatal("could not create memory profile: ", err)
+			log.StreamLogger.Fatal("could not create memory profile: %v", err)
 		}
 		defer f.Close()
 		runtime.GC() // get up-to-date statistics
 		if err := pprof.WriteHeapProfile(f); err != nil {
-			log.StreamLogger.Fatal("could not write memory profile: ", err)
+			log.StreamLogger.Fatal("could not write memory profile: %v", err)
 		}
 		log.StreamLogger.Info("mem pprof done [file=%s]!", memprofile)
 	}
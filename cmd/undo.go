@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/log"
+	"go-oak-chunk/v2/task"
+	"go-oak-chunk/v2/vars"
+)
+
+var undoPath string
+
+var undoCmd = &cobra.Command{
+	Use:     "undo",
+	Short:   "Undo a chunk dml by its undo log",
+	Long:    `Replay the undo log written by run --undo-file from the last chunk to the first one, with the same throttling as run`,
+	Example: fmt.Sprintf("%s undo --file <undo file> -H <host> -P <port> -u <user> -p <password> -d <database>\n", vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.StreamLogger.Debug("Go-oak-chunk undo...")
+
+		if undoPath == "" {
+			err := errors.New("undo log must be provided via --file")
+			log.StreamLogger.Error(err.Error())
+			return err
+		}
+		if includeSlaves != "" && excludeSlaves != "" {
+			err := errors.New("--include-slaves and --exclude-slaves are mutually exclusive")
+			log.StreamLogger.Error(err.Error())
+			return err
+		}
+
+		config := &conf.Config{
+			Host:             host,
+			Port:             port,
+			User:             user,
+			Password:         password,
+			Database:         database,
+			TxnSize:          txnSize,
+			Sleep:            sleep,
+			MaxLag:           maxLag,
+			NoConsiderLag:    noConsiderLag,
+			IncludeSlaves:    includeSlaves,
+			ExcludeSlaves:    excludeSlaves,
+			ControlSocket:    controlSocket,
+			MaxLoad:          maxLoad,
+			CriticalLoad:     criticalLoad,
+			ThrottleQuery:    throttleQuery,
+			ThrottleFlagFile: throttleFlagFile,
+			ThrottleHTTP:     throttleHTTP,
+			Windows:          windows,
+			TimeZone:         timeZone,
+			PrintProgress:    printProgress,
+			Debug:            debug,
+		}
+		config.SetLogLevel()
+
+		ctx, cancel := notifyContext(nil)
+		defer cancel()
+
+		err := task.RunUndo(ctx, config, undoPath)
+		if errors.Is(err, context.Canceled) {
+			os.Exit(vars.ExitInterrupted)
+		} else if err != nil {
+			log.StreamLogger.Error(err.Error())
+			return err
+		}
+		return nil
+	},
+}
+
+func initUndo() {
+	undoCmd.Flags().StringVar(&undoPath, "file", "", "undo log written by run --undo-file")
+	undoCmd.Flags().StringVarP(&host, "host", "H", "localhost", "MySQL host")
+	undoCmd.Flags().IntVarP(&port, "port", "P", 3306, "TCP/IP port")
+	undoCmd.Flags().StringVarP(&user, "user", "u", "root", "MySQL user")
+	undoCmd.Flags().StringVarP(&password, "password", "p", "", "MySQL password")
+	undoCmd.Flags().StringVarP(&database, "database", "d", "", "Database to connect, stmts of undo log are qualified by database")
+	undoCmd.Flags().Int64Var(&txnSize, "txn-size", 1000, "Number of rows per transaction.")
+	undoCmd.Flags().Int64Var(&sleep, "sleep", 0, "Number of seconds to sleep between transactions.")
+	undoCmd.Flags().Int64Var(&maxLag, "max-lag", 0, "Pause if the slave reach Threshold.")
+	undoCmd.Flags().BoolVar(&noConsiderLag, "noConsiderLag", false, "If true: sleep value will not be overshoot\nfalse: if slave lag is very high, sleep will be overshoot")
+	undoCmd.Flags().StringVar(&includeSlaves, "include-slaves", "", "which slaves should be include, include_slaves and exclude_slaves are mutually exclusive.\nex: ip or ip1,ip2,... without port")
+	undoCmd.Flags().StringVar(&excludeSlaves, "exclude-slaves", "", "which slaves should be include, include_slaves and exclude_slaves are mutually exclusive.\nex: ip or ip1,ip2,... without port")
+	undoCmd.Flags().StringVar(&controlSocket, "control-socket", "", "Unix socket to pause/resume/abort the undo or change sleep, max-lag and txn-size while it's running.\nex: echo 'set sleep=2' | nc -U <socket>")
+	undoCmd.Flags().StringVar(&maxLoad, "max-load", "", "Pause new txns while a global status of source is over the threshold, checked every second.\nex: Threads_running=50,Threads_connected=1000")
+	undoCmd.Flags().StringVar(&criticalLoad, "critical-load", "", "Finish the open txn and abort when a global status of source is over the threshold.\nex: Threads_running=200")
+	undoCmd.Flags().StringVar(&throttleQuery, "throttle-query", "", "Pause new txns while this SELECT on source returns a non-zero number, checked every second")
+	undoCmd.Flags().StringVar(&throttleFlagFile, "throttle-flag-file", "", "Pause new txns while this file exists")
+	undoCmd.Flags().StringVar(&throttleHTTP, "throttle-http", "", "Pause new txns unless GET of this url returns 200, checked every second")
+	undoCmd.Flags().StringSliceVar(&windows, "windows", nil, "Maintenance windows in which new txns are started, out of them the undo waits for the next one.\nex: \"01:00-05:00,Sat 00:00-Sun 23:59\", the end is excluded")
+	undoCmd.Flags().StringVar(&timeZone, "time-zone", "", "IANA time zone of --windows, ex: Asia/Shanghai. Default is the local time zone")
+	undoCmd.Flags().BoolVar(&printProgress, "print-progress", false, "Print a line after every transaction")
+	undoCmd.Flags().BoolVar(&debug, "debug", false, "If debug_mode is true, print debug logs")
+	rootCmd.AddCommand(undoCmd)
+}
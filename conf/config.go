@@ -3,6 +3,8 @@ package conf
 import (
 	"fmt"
 	"os"
+	"sync/atomic"
+	"time"
 
 	"github.com/pelletier/go-toml"
 	"github.com/realcp1018/tinylog"
@@ -31,6 +33,61 @@ type Config struct {
 	Database string `toml:"database"`
 	TxnSize  int64  `toml:"txn_size"`
 	Debug    bool   `toml:"debug_mode"`
+	DryRun   bool   `toml:"dry_run"`
+	// warn, abort or off
+	ExplainCheck string `toml:"explain_check"`
+	// save the progress to this file after every commit
+	CheckpointFile string `toml:"checkpoint_file"`
+	// save the progress to table _goc_jobs of database after every commit, keyed by JobId
+	CheckpointTable bool   `toml:"checkpoint_table"`
+	JobId           string `toml:"job_id"`
+	// unix socket to change sleep, max_lag and txn_size, pause or abort while job is running
+	ControlSocket string `toml:"control_socket"`
+	// serve json status on /status and prometheus metrics on /metrics, ex: 127.0.0.1:9100
+	HTTPAddr string `toml:"http_addr"`
+	// plain, json or tui of PrintProgress, tui if stdout is a terminal else plain when it's empty
+	ProgressFormat string `toml:"progress_format"`
+	// seconds between two progress outputs, default 3
+	ProgressInterval int64 `toml:"progress_interval"`
+	// write a json report of the run to this file when job returns
+	ReportFile string `toml:"report_file"`
+	// count the rows before writing and ask for confirmation unless AssumeYes
+	PreCount  bool `toml:"precount"`
+	AssumeYes bool `toml:"assume_yes"`
+	// abort and rollback the txn when rows affected exceed MaxAffectedRows, or PreCount by MaxAffectedPercent
+	MaxAffectedRows    int64   `toml:"max_affected_rows"`
+	MaxAffectedPercent float64 `toml:"max_affected_percent"`
+	// walk the table again after the job to find the rows left by concurrent writes, and run them again if VerifyRerun
+	Verify      bool `toml:"verify"`
+	VerifyRerun bool `toml:"verify_rerun"`
+	// table name or alias which multi-table update/delete is chunked on
+	DrivingTable string `toml:"driving_table"`
+	// copy the rows of every chunk to this file before they are deleted, csv, json or sql
+	ArchiveFile   string `toml:"archive_file"`
+	ArchiveFormat string `toml:"archive_format"`
+	// copy the rows of every chunk to dest table before they are deleted, [user[:pass]@]host[:port]/db/table
+	Dest string `toml:"dest"`
+	// write the before-image of every chunk as reverse stmts to this file, replayed by `goc undo --file`
+	UndoFile string `toml:"undo_file"`
+	// split the range of leading key into Workers ranges, every range is run by its own reader and writer in parallel
+	Workers int64 `toml:"workers"`
+	// new txns are started only in these maintenance windows of TimeZone, ex: ["01:00-05:00", "Sat 00:00-Sun 23:59"]
+	Windows  []string `toml:"windows"`
+	TimeZone string   `toml:"time_zone"`
+	// thresholds of global status of the source, ex: "Threads_running=50". New txns wait while any of them is over
+	// MaxLoad, and job is aborted once any of them is over CriticalLoad
+	MaxLoad      string `toml:"max_load"`
+	CriticalLoad string `toml:"critical_load"`
+	// new txns wait while ThrottleQuery returns non-zero, ThrottleFlagFile exists or ThrottleHTTP doesn't return 200
+	ThrottleQuery    string `toml:"throttle_query"`
+	ThrottleFlagFile string `toml:"throttle_flag_file"`
+	ThrottleHTTP     string `toml:"throttle_http"`
+	// chunk size starts from ChunkSize and is adjusted to make every chunk take ChunkTime, ex: "0.5s"
+	ChunkTime time.Duration `toml:"chunk_time"`
+	// continue from CheckpointFile, only set by resume cmd
+	Resume bool `toml:"-"`
+	// password of Dest which isn't saved in checkpoint, only set by resume cmd
+	DestPassword string `toml:"-"`
 
 	// 修正
 	Correct int64 `toml:"correct"`
@@ -54,26 +111,167 @@ func NewConfig(configPath string) (*Config, error) {
 
 func (c *Config) PreCheck() {
 	// config precheck
-	if c.Debug {
-		log.GlobalLogger.SetLevel(tinylog.LogLevel(vars.DEBUG))
-		log.StreamLogger.SetLevel(tinylog.LogLevel(vars.DEBUG))
-	} else {
-		log.GlobalLogger.SetLevel(tinylog.LogLevel(vars.ERROR))
-		log.StreamLogger.SetLevel(tinylog.LogLevel(vars.ERROR))
-	}
+	c.SetLogLevel()
 
 	if c.ChunkSize < 0 {
 		log.StreamLogger.Error("Chunk size must be nonnegative number. You can leave the default 1000 if unsure")
 		os.Exit(1)
 	}
 
+	if c.ChunkTime < 0 {
+		log.StreamLogger.Error("chunk_time must be nonnegative duration")
+		os.Exit(1)
+	}
+	if c.ChunkTime > 0 && c.ChunkSize <= 1 {
+		log.StreamLogger.Error("chunk_time adjusts the rows of chunks, chunk_size must be greater than 1")
+		os.Exit(1)
+	}
+
 	if c.ExecuteQuery == "" {
 		log.StreamLogger.Error("Query to execute must be provided via -e or --execute")
 		os.Exit(1)
 	}
 
+	switch c.ExplainCheck {
+	case "":
+		c.ExplainCheck = vars.ExplainCheckWarn
+	case vars.ExplainCheckWarn, vars.ExplainCheckAbort, vars.ExplainCheckOff:
+	default:
+		log.StreamLogger.Error("explain_check must be one of warn, abort or off")
+		os.Exit(1)
+	}
+
+	if c.CheckpointTable && c.CheckpointFile != "" {
+		log.StreamLogger.Error("checkpoint_file and checkpoint_table are mutually exclusive.")
+		os.Exit(1)
+	}
+
+	if c.CheckpointTable && (c.JobId == "" || len(c.JobId) > 64) {
+		log.StreamLogger.Error("job_id must be provided via --job-id when checkpoint_table is enabled, and no longer than 64")
+		os.Exit(1)
+	}
+
+	switch c.ProgressFormat {
+	case "", vars.ProgressFormatPlain, vars.ProgressFormatJSON, vars.ProgressFormatTUI:
+	default:
+		log.StreamLogger.Error("progress_format must be one of plain, json or tui")
+		os.Exit(1)
+	}
+
+	if c.ProgressInterval < 0 {
+		log.StreamLogger.Error("progress_interval must be nonnegative number")
+		os.Exit(1)
+	}
+	if c.ProgressInterval == 0 {
+		c.ProgressInterval = 3
+	}
+
+	switch c.ArchiveFormat {
+	case "":
+		c.ArchiveFormat = vars.ArchiveFormatCSV
+	case vars.ArchiveFormatCSV, vars.ArchiveFormatJSON, vars.ArchiveFormatSQL:
+	default:
+		log.StreamLogger.Error("archive_format must be one of csv, json or sql")
+		os.Exit(1)
+	}
+
+	if c.Dest != "" {
+		if c.ArchiveFile != "" {
+			log.StreamLogger.Error("archive_file and dest are mutually exclusive.")
+			os.Exit(1)
+		}
+		if _, err := ParseDest(c.Dest); err != nil {
+			log.StreamLogger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if c.MaxAffectedRows < 0 || c.MaxAffectedPercent < 0 {
+		log.StreamLogger.Error("max_affected_rows and max_affected_percent must be nonnegative number")
+		os.Exit(1)
+	}
+
+	if c.MaxAffectedPercent > 0 && !c.PreCount {
+		log.StreamLogger.Error("max_affected_percent is based on the pre-count, precount must be enabled")
+		os.Exit(1)
+	}
+
+	if c.VerifyRerun && !c.Verify {
+		log.StreamLogger.Error("verify_rerun runs the rows found by verify again, verify must be enabled")
+		os.Exit(1)
+	}
+
 	if c.IncludeSlaves != "" && c.ExcludeSlaves != "" {
 		log.StreamLogger.Error("--include-slaves and --exclude-slaves are mutually exclusive.")
 		os.Exit(1)
 	}
+
+	if _, err := ParseWindows(c.Windows, c.TimeZone); err != nil {
+		log.StreamLogger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	for _, load := range []string{c.MaxLoad, c.CriticalLoad} {
+		if _, err := ParseLoad(load); err != nil {
+			log.StreamLogger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if err := CheckThrottle(c.ThrottleQuery, c.ThrottleHTTP); err != nil {
+		log.StreamLogger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if c.Workers < 0 {
+		log.StreamLogger.Error("workers must be nonnegative number")
+		os.Exit(1)
+	}
+	if c.Workers == 0 {
+		c.Workers = 1
+	}
+	// the progress of workers can't be saved as one key, and rows of concurrent txns can't be archived in order
+	if c.Workers > 1 {
+		if c.ChunkSize == 0 {
+			log.StreamLogger.Error("workers split the key range into chunks, chunk_size must not be 0")
+			os.Exit(1)
+		}
+		if c.CheckpointFile != "" || c.CheckpointTable || c.Resume {
+			log.StreamLogger.Error("workers can't save checkpoint, checkpoint_file and checkpoint_table must be empty")
+			os.Exit(1)
+		}
+		if c.ArchiveFile != "" || c.Dest != "" || c.UndoFile != "" {
+			log.StreamLogger.Error("workers can't be used with archive_file, dest or undo_file")
+			os.Exit(1)
+		}
+	}
+}
+
+// SetLogLevel prints debug logs if Debug, otherwise only errors
+func (c *Config) SetLogLevel() {
+	if c.Debug {
+		log.GlobalLogger.SetLevel(tinylog.LogLevel(vars.DEBUG))
+		log.StreamLogger.SetLevel(tinylog.LogLevel(vars.DEBUG))
+	} else {
+		log.GlobalLogger.SetLevel(tinylog.LogLevel(vars.ERROR))
+		log.StreamLogger.SetLevel(tinylog.LogLevel(vars.ERROR))
+	}
+}
+
+// GetSleep returns Sleep, which can be changed by control socket while job is running
+func (c *Config) GetSleep() int64 {
+	return atomic.LoadInt64(&c.Sleep)
+}
+
+func (c *Config) SetSleep(sleep int64) {
+	atomic.StoreInt64(&c.Sleep, sleep)
+}
+
+// GetMaxLag returns MaxLag, which can be changed by control socket while job is running
+func (c *Config) GetMaxLag() int64 {
+	return atomic.LoadInt64(&c.MaxLag)
+}
+
+func (c *Config) SetMaxLag(maxLag int64) {
+	atomic.StoreInt64(&c.MaxLag, maxLag)
 }
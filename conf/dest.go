@@ -0,0 +1,71 @@
+package conf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dest is where the rows are archived to before they are deleted, parsed from [user[:pass]@]host[:port]/db/table
+type Dest struct {
+	User     string
+	Password string
+	Host     string
+	Port     int
+	Database string
+	Table    string
+}
+
+// ParseDest parses dest, user, password and port are empty if omitted
+func ParseDest(dest string) (*Dest, error) {
+	d := new(Dest)
+	addr := dest
+	if i := strings.LastIndex(dest, "@"); i >= 0 {
+		addr = dest[i+1:]
+		d.User, d.Password, _ = strings.Cut(dest[:i], ":")
+	}
+
+	parts := strings.Split(addr, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("dest must be [user[:pass]@]host[:port]/db/table, got: %s", dest)
+	}
+	d.Database, d.Table = parts[1], parts[2]
+
+	host, port, found := strings.Cut(parts[0], ":")
+	d.Host = host
+	if found {
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 {
+			return nil, fmt.Errorf("port of dest is invalid, got: %s", dest)
+		}
+		d.Port = p
+	}
+	return d, nil
+}
+
+// DestInfo returns the parsed Dest, user and port omitted are the same as the source.
+// Password omitted is DestPassword, or the same as the source if it's empty too.
+func (c *Config) DestInfo() (*Dest, error) {
+	d, err := ParseDest(c.Dest)
+	if err != nil {
+		return nil, err
+	}
+	if d.User == "" {
+		d.User = c.User
+	}
+	if d.Password == "" {
+		d.Password = c.DestPassword
+	}
+	if d.Password == "" {
+		d.Password = c.Password
+	}
+	if d.Port == 0 {
+		d.Port = c.Port
+	}
+	return d, nil
+}
+
+// String returns dest without password, which is saved in checkpoint
+func (d *Dest) String() string {
+	return fmt.Sprintf("%s@%s:%d/%s/%s", d.User, d.Host, d.Port, d.Database, d.Table)
+}
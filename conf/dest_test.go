@@ -0,0 +1,37 @@
+package conf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDestInfo(t *testing.T) {
+	c := &Config{User: "root", Password: "src", Port: 3306}
+	cases := map[string]*Dest{
+		"10.0.0.1/archive/t1_his":               {User: "root", Password: "src", Host: "10.0.0.1", Port: 3306, Database: "archive", Table: "t1_his"},
+		"goc:p@ss@10.0.0.1:3307/archive/t1_his": {User: "goc", Password: "p@ss", Host: "10.0.0.1", Port: 3307, Database: "archive", Table: "t1_his"},
+		"goc@127.0.0.1/archive/t1_his":          {User: "goc", Password: "src", Host: "127.0.0.1", Port: 3306, Database: "archive", Table: "t1_his"},
+	}
+	for dest, expected := range cases {
+		c.Dest = dest
+		d, err := c.DestInfo()
+		if err != nil {
+			t.Fatalf("%s got err: %v", dest, err)
+		}
+		if !reflect.DeepEqual(d, expected) {
+			t.Fatalf("%s got: %+v, expected: %+v", dest, d, expected)
+		}
+	}
+
+	// dest saved in checkpoint has no password, it's given by resume --dest-password
+	c.Dest, c.DestPassword = "goc@127.0.0.1:3306/archive/t1_his", "dst"
+	if d, err := c.DestInfo(); err != nil || d.Password != "dst" {
+		t.Fatalf("got dest %+v, err: %v, expected password of --dest-password", d, err)
+	}
+
+	for _, dest := range []string{"10.0.0.1/archive", "10.0.0.1:x/archive/t1", "/archive/t1", "10.0.0.1/archive/t1/x"} {
+		if _, err := ParseDest(dest); err == nil {
+			t.Fatalf("%s should be invalid", dest)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package conf
+
+import (
+	"fmt"
+
+	"github.com/pelletier/go-toml"
+
+	"go-oak-chunk/v2/vars"
+)
+
+// Jobs are chunk dmls which run in order, or Parallel of them at the same time. The settings at top level of jobs file are shared by every job,
+// and overridden by the table of the job in [[jobs]], ex: execute_query, database, chunk_size, txn_size and sleep.
+type Jobs struct {
+	Jobs []*Job
+	// ReportFile is the combined report of all jobs, report_file of a job is the report of itself
+	ReportFile string
+	// Parallel is how many jobs run at the same time, they share one token bucket and the lag checker of an instance
+	Parallel int
+}
+
+type Job struct {
+	Name   string
+	Config *Config
+}
+
+func NewJobs(path string) (*Jobs, error) {
+	tree, err := toml.LoadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load jobs file, %s", err.Error())
+	}
+	jobTrees, ok := tree.Get("jobs").([]*toml.Tree)
+	if !ok || len(jobTrees) == 0 {
+		return nil, fmt.Errorf("no [[jobs]] in jobs file %s", path)
+	}
+
+	jobs := &Jobs{Parallel: 1}
+	if reportFile, ok := tree.Get("report_file").(string); ok {
+		jobs.ReportFile = reportFile
+	}
+
+	checkpoints := make(map[string]string)
+	for i, jobTree := range jobTrees {
+		// correct is 50 as run cmd if it's not in jobs file
+		job := &Job{Name: fmt.Sprintf("job-%d", i+1), Config: &Config{Correct: 50}}
+		if name, ok := jobTree.Get("name").(string); ok && name != "" {
+			job.Name = name
+		}
+
+		// every job has its own copy of the shared settings
+		if err = tree.Unmarshal(job.Config); err != nil {
+			return nil, err
+		}
+		job.Config.ReportFile = ""
+		if err = jobTree.Unmarshal(job.Config); err != nil {
+			return nil, fmt.Errorf("job %s: %s", job.Name, err.Error())
+		}
+
+		// the progress of jobs can't be saved in the same checkpoint
+		checkpoint := job.Config.CheckpointFile
+		if job.Config.CheckpointTable {
+			checkpoint = "job_id " + job.Config.JobId
+		}
+		if checkpoint != "" {
+			if other, ok := checkpoints[checkpoint]; ok {
+				return nil, fmt.Errorf("job %s and %s have the same checkpoint %s", other, job.Name, checkpoint)
+			}
+			checkpoints[checkpoint] = job.Name
+		}
+
+		job.Config.PreCheck()
+		jobs.Jobs = append(jobs.Jobs, job)
+	}
+
+	if parallel, ok := tree.Get("parallel").(int64); ok {
+		if err = jobs.SetParallel(int(parallel)); err != nil {
+			return nil, err
+		}
+	}
+	return jobs, nil
+}
+
+// SetParallel sets how many jobs run at the same time. Jobs running in parallel can't ask for confirmation,
+// share the terminal with tui progress, or listen on the same control socket or http address.
+func (j *Jobs) SetParallel(parallel int) error {
+	if parallel < 1 {
+		return fmt.Errorf("parallel must be greater than 0, got %d", parallel)
+	}
+	j.Parallel = parallel
+	if parallel == 1 {
+		return nil
+	}
+
+	listens := make(map[string]string)
+	for _, job := range j.Jobs {
+		c := job.Config
+		if c.PreCount && !c.AssumeYes {
+			return fmt.Errorf("job %s: precount of parallel jobs requires assume_yes", job.Name)
+		}
+		if c.ProgressFormat == vars.ProgressFormatTUI {
+			return fmt.Errorf("job %s: progress_format tui can't be used by parallel jobs, use plain or json", job.Name)
+		}
+		if c.ProgressFormat == "" {
+			c.ProgressFormat = vars.ProgressFormatPlain
+		}
+
+		for _, addr := range []string{c.ControlSocket, c.HTTPAddr} {
+			if addr == "" {
+				continue
+			}
+			if other, ok := listens[addr]; ok {
+				return fmt.Errorf("job %s and %s can't listen on the same %s in parallel", other, job.Name, addr)
+			}
+			listens[addr] = job.Name
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-oak-chunk/v2/vars"
+)
+
+func TestNewJobs(t *testing.T) {
+	content := `
+host = "127.0.0.1"
+port = 3306
+database = "db1"
+chunk_size = 1000
+txn_size = 2000
+sleep = 1
+correct = 50
+report_file = "all.json"
+
+[[jobs]]
+name = "purge_log"
+execute_query = "delete from log where created_at < '2024-01-01'"
+checkpoint_file = "purge_log.checkpoint"
+
+[[jobs]]
+execute_query = "delete from event where created_at < '2024-01-01'"
+database = "db2"
+chunk_size = 500
+sleep = 0
+report_file = "event.json"
+`
+	path := filepath.Join(t.TempDir(), "jobs.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := NewJobs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs.ReportFile != "all.json" || len(jobs.Jobs) != 2 {
+		t.Fatalf("got report file %s and %d jobs", jobs.ReportFile, len(jobs.Jobs))
+	}
+
+	first, second := jobs.Jobs[0], jobs.Jobs[1]
+	if first.Name != "purge_log" || first.Config.Database != "db1" || first.Config.ChunkSize != 1000 ||
+		first.Config.Sleep != 1 || first.Config.CheckpointFile != "purge_log.checkpoint" || first.Config.ReportFile != "" {
+		t.Fatalf("unexpected first job: %s %+v", first.Name, first.Config)
+	}
+	if second.Name != "job-2" || second.Config.Database != "db2" || second.Config.ChunkSize != 500 || second.Config.TxnSize != 2000 ||
+		second.Config.Sleep != 0 || second.Config.CheckpointFile != "" || second.Config.ReportFile != "event.json" || second.Config.Host != "127.0.0.1" {
+		t.Fatalf("unexpected second job: %s %+v", second.Name, second.Config)
+	}
+	if first.Config == second.Config {
+		t.Fatal("jobs must not share config")
+	}
+
+	// jobs can't save progress to the same checkpoint
+	content = "checkpoint_file = \"shared.checkpoint\"\n[[jobs]]\nexecute_query = \"delete from a where id < 10\"\n[[jobs]]\nexecute_query = \"delete from b where id < 10\"\n"
+	if err = os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewJobs(path); err == nil {
+		t.Fatal("jobs with the same checkpoint file should be rejected")
+	}
+
+	if err = os.WriteFile(path, []byte("host = \"127.0.0.1\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewJobs(path); err == nil {
+		t.Fatal("jobs file without [[jobs]] should be rejected")
+	}
+}
+
+func TestJobsParallel(t *testing.T) {
+	content := `
+parallel = 2
+precount = true
+assume_yes = true
+print_progress = true
+
+[[jobs]]
+execute_query = "delete from a where id < 10"
+checkpoint_file = "a.checkpoint"
+
+[[jobs]]
+execute_query = "delete from b where id < 10"
+checkpoint_file = "b.checkpoint"
+http_addr = "127.0.0.1:9100"
+`
+	path := filepath.Join(t.TempDir(), "jobs.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := NewJobs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs.Parallel != 2 {
+		t.Fatalf("got parallel %d", jobs.Parallel)
+	}
+	// parallel jobs print plain progress instead of tui
+	for _, job := range jobs.Jobs {
+		if job.Config.ProgressFormat != vars.ProgressFormatPlain {
+			t.Fatalf("got progress format %q of job %s", job.Config.ProgressFormat, job.Name)
+		}
+	}
+
+	if err = jobs.SetParallel(0); err == nil {
+		t.Fatal("parallel 0 should be rejected")
+	}
+	jobs.Jobs[0].Config.HTTPAddr = "127.0.0.1:9100"
+	if err = jobs.SetParallel(2); err == nil {
+		t.Fatal("parallel jobs with the same http addr should be rejected")
+	}
+	// they can listen on the same address one after another
+	if err = jobs.SetParallel(1); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs.Jobs[0].Config.HTTPAddr = ""
+	jobs.Jobs[1].Config.AssumeYes = false
+	if err = jobs.SetParallel(2); err == nil {
+		t.Fatal("parallel jobs asking for confirmation should be rejected")
+	}
+}
@@ -0,0 +1,33 @@
+package conf
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var statusNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseLoad parses the thresholds of global status variables, ex: "Threads_running=50,Threads_connected=500".
+// It returns nil if s is empty.
+func ParseLoad(s string) (map[string]int64, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	thresholds := make(map[string]int64)
+	for _, item := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		name = strings.TrimSpace(name)
+		if !ok || !statusNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("invalid load %q, the format is Variable_name=value,...", item)
+		}
+		threshold, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || threshold <= 0 {
+			return nil, fmt.Errorf("invalid load %q, the threshold must be a positive integer", item)
+		}
+		thresholds[name] = threshold
+	}
+	return thresholds, nil
+}
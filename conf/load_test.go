@@ -0,0 +1,26 @@
+package conf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLoad(t *testing.T) {
+	thresholds, err := ParseLoad("Threads_running=50, Threads_connected = 500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int64{"Threads_running": 50, "Threads_connected": 500}
+	if !reflect.DeepEqual(thresholds, expected) {
+		t.Fatalf("got %v, expected %v", thresholds, expected)
+	}
+
+	if thresholds, err = ParseLoad(""); err != nil || thresholds != nil {
+		t.Fatalf("empty load got %v, %v", thresholds, err)
+	}
+	for _, load := range []string{"Threads_running", "Threads_running=0", "Threads_running=abc", "x') or 1=1 -- =1"} {
+		if _, err = ParseLoad(load); err == nil {
+			t.Fatalf("load %q should be rejected", load)
+		}
+	}
+}
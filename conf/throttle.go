@@ -0,0 +1,24 @@
+package conf
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// CheckThrottle makes sure throttle_query is a single SELECT and throttle_http is a http(s) url
+func CheckThrottle(query, httpURL string) error {
+	if query != "" {
+		q := strings.TrimSpace(query)
+		if !strings.HasPrefix(strings.ToLower(q), "select") || strings.Contains(strings.TrimSuffix(q, ";"), ";") {
+			return fmt.Errorf("throttle_query %q must be a single SELECT stmt", query)
+		}
+	}
+	if httpURL != "" {
+		u, err := url.Parse(httpURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("throttle_http %q must be a http or https url", httpURL)
+		}
+	}
+	return nil
+}
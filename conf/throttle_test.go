@@ -0,0 +1,22 @@
+package conf
+
+import "testing"
+
+func TestCheckThrottle(t *testing.T) {
+	if err := CheckThrottle("", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckThrottle(" SELECT count(*) > 100 FROM ops.throttle;", "http://127.0.0.1:8080/ready"); err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{"delete from ops.throttle", "select 1; drop table t"} {
+		if err := CheckThrottle(query, ""); err == nil {
+			t.Fatalf("throttle_query %q should be rejected", query)
+		}
+	}
+	for _, u := range []string{"127.0.0.1:8080/ready", "ftp://127.0.0.1/ready", "http://"} {
+		if err := CheckThrottle("", u); err == nil {
+			t.Fatalf("throttle_http %q should be rejected", u)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package conf
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	secondsOfDay  = 24 * 60 * 60
+	secondsOfWeek = 7 * secondsOfDay
+)
+
+var weekdays = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// Windows are the maintenance windows in which chunk dml is allowed to run
+type Windows struct {
+	loc *time.Location
+	// ranges are [start, end) seconds of week from Sunday 00:00, end may be greater than secondsOfWeek
+	ranges [][2]int
+}
+
+// ParseWindows parses windows of "HH:MM-HH:MM" every day or "Day HH:MM-Day HH:MM" every week, ex: "01:00-05:00",
+// "22:00-02:00" and "Sat 00:00-Sun 23:59". The end is excluded. timeZone is a name of IANA time zone, local if empty.
+// It returns nil if there is no window, which means always.
+func ParseWindows(specs []string, timeZone string) (*Windows, error) {
+	loc := time.Local
+	if timeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(timeZone); err != nil {
+			return nil, fmt.Errorf("invalid time_zone %s, %s", timeZone, err.Error())
+		}
+	}
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	ws := &Windows{loc: loc}
+	for _, spec := range specs {
+		start, end, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid window %q, the format is HH:MM-HH:MM or Day HH:MM-Day HH:MM", spec)
+		}
+		startDay, startSec, err := parseWindowTime(start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window %q, %s", spec, err.Error())
+		}
+		endDay, endSec, err := parseWindowTime(end)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window %q, %s", spec, err.Error())
+		}
+		if (startDay < 0) != (endDay < 0) {
+			return nil, fmt.Errorf("invalid window %q, both or neither of start and end have a day", spec)
+		}
+
+		if startDay < 0 {
+			// every day, it ends at the next day if end isn't after start
+			if endSec == startSec {
+				return nil, fmt.Errorf("invalid window %q, start and end are the same", spec)
+			}
+			if endSec < startSec {
+				endSec += secondsOfDay
+			}
+			for day := 0; day < 7; day++ {
+				ws.ranges = append(ws.ranges, [2]int{day*secondsOfDay + startSec, day*secondsOfDay + endSec})
+			}
+			continue
+		}
+
+		from, to := startDay*secondsOfDay+startSec, endDay*secondsOfDay+endSec
+		if from == to {
+			return nil, fmt.Errorf("invalid window %q, start and end are the same", spec)
+		}
+		if to < from {
+			to += secondsOfWeek
+		}
+		ws.ranges = append(ws.ranges, [2]int{from, to})
+	}
+	return ws, nil
+}
+
+// parseWindowTime parses "HH:MM" or "Day HH:MM", day is -1 if it's not specified
+func parseWindowTime(s string) (day int, sec int, err error) {
+	day = -1
+	fields := strings.Fields(s)
+	if len(fields) == 2 {
+		d, ok := weekdays[strings.ToLower(fields[0])]
+		if !ok {
+			return 0, 0, fmt.Errorf("unknown day %s", fields[0])
+		}
+		day = d
+		fields = fields[1:]
+	}
+	if len(fields) != 1 {
+		return 0, 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	var hour, minute int
+	if n, err := fmt.Sscanf(fields[0], "%d:%d", &hour, &minute); err != nil || n != 2 ||
+		hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid time %q", s)
+	}
+	return day, hour*3600 + minute*60, nil
+}
+
+// Contains returns true if t is in a window
+func (ws *Windows) Contains(t time.Time) bool {
+	if ws == nil {
+		return true
+	}
+	sec := ws.secondOfWeek(t)
+	for _, r := range ws.ranges {
+		// a range crossing the end of week also covers the beginning of it
+		if (sec >= r[0] && sec < r[1]) || (sec+secondsOfWeek >= r[0] && sec+secondsOfWeek < r[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the start of the next window after t
+func (ws *Windows) Next(t time.Time) time.Time {
+	sec := ws.secondOfWeek(t)
+	wait := secondsOfWeek
+	for _, r := range ws.ranges {
+		if d := ((r[0]-sec)%secondsOfWeek + secondsOfWeek) % secondsOfWeek; d > 0 && d < wait {
+			wait = d
+		}
+	}
+	return t.Truncate(time.Second).Add(time.Duration(wait) * time.Second)
+}
+
+func (ws *Windows) secondOfWeek(t time.Time) int {
+	t = t.In(ws.loc)
+	return int(t.Weekday())*secondsOfDay + t.Hour()*3600 + t.Minute()*60 + t.Second()
+}
@@ -0,0 +1,63 @@
+package conf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindows(t *testing.T) {
+	ws, err := ParseWindows([]string{"01:00-05:00", "22:30-00:30", "Sat 00:00-Sun 23:59"}, "Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+	at := func(day, hour, minute int) time.Time {
+		// 2024-01-01 is Monday
+		return time.Date(2024, 1, day, hour, minute, 0, 0, loc)
+	}
+	cases := []struct {
+		t        time.Time
+		contains bool
+		next     time.Time
+	}{
+		{at(1, 1, 0), true, at(1, 22, 30)},
+		{at(1, 4, 59), true, at(1, 22, 30)},
+		{at(1, 5, 0), false, at(1, 22, 30)},
+		{at(1, 12, 0), false, at(1, 22, 30)},
+		{at(1, 23, 0), true, at(2, 1, 0)},
+		{at(2, 0, 15), true, at(2, 1, 0)},
+		{at(2, 0, 30), false, at(2, 1, 0)},
+		{at(5, 12, 0), false, at(5, 22, 30)},
+		{at(6, 0, 0), true, at(6, 1, 0)},
+		{at(7, 12, 0), true, at(7, 22, 30)},
+		{at(7, 23, 59), true, at(8, 1, 0)},
+	}
+	for _, c := range cases {
+		if got := ws.Contains(c.t); got != c.contains {
+			t.Fatalf("Contains(%s) = %v, expected %v", c.t, got, c.contains)
+		}
+		if got := ws.Next(c.t); !got.Equal(c.next) {
+			t.Fatalf("Next(%s) = %s, expected %s", c.t, got.In(loc), c.next)
+		}
+	}
+
+	// the same time in another time zone
+	if ws.Contains(time.Date(2024, 1, 1, 4, 0, 0, 0, time.UTC)) {
+		t.Fatal("12:00 in Asia/Shanghai isn't in windows")
+	}
+
+	var none *Windows
+	if ws, err = ParseWindows(nil, ""); err != nil || ws != none || !ws.Contains(time.Now()) {
+		t.Fatalf("no window should mean always, got %v, %v", ws, err)
+	}
+
+	for _, spec := range []string{"01:00", "01:00-01:00", "25:00-26:00", "Sat 01:00-05:00", "Xyz 01:00-Sun 02:00", "1-5"} {
+		if _, err = ParseWindows([]string{spec}, ""); err == nil {
+			t.Fatalf("window %q should be rejected", spec)
+		}
+	}
+	if _, err = ParseWindows(nil, "Mars/Olympus"); err == nil {
+		t.Fatal("unknown time zone should be rejected")
+	}
+}
@@ -12,6 +12,7 @@ require (
 	github.com/pingcap/parser v0.0.0-20210525032559-c37778aff307
 	github.com/realcp1018/tinylog v1.0.4
 	github.com/spf13/cobra v1.6.1
+	github.com/tidwall/gjson v1.7.5
 )
 
 require (
@@ -59,7 +60,6 @@ require (
 	github.com/shiena/ansicolor v0.0.0-20151119151921-a422bbe96644 // indirect
 	github.com/shirou/gopsutil v3.21.2+incompatible // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	github.com/tidwall/gjson v1.7.5 // indirect
 	github.com/tidwall/match v1.0.3 // indirect
 	github.com/tidwall/pretty v1.1.0 // indirect
 	github.com/tikv/pd v1.1.0-beta.0.20210323121136-78679e5e209d // indirect
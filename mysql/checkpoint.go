@@ -0,0 +1,220 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/vars"
+)
+
+// Checkpoint is the progress of a job, which is saved after every commit
+type Checkpoint struct {
+	// Config is the config of job without password
+	Config     *conf.Config       `json:"config"`
+	Database   string             `json:"database"`
+	Table      string             `json:"table"`
+	SqlType    string             `json:"sql_type"`
+	ExecuteSQL string             `json:"execute_sql"`
+	UniqueKey  []string           `json:"unique_key"`
+	KeyValues  []*CheckpointValue `json:"key_values"`
+	RowAffects int64              `json:"row_affects"`
+	Status     string             `json:"status"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+}
+
+// CheckpointValue saves key value as string, so that bigint won't lose precision
+type CheckpointValue struct {
+	Column string `json:"column"`
+	Value  string `json:"value"`
+}
+
+// CheckpointStore is where the checkpoint of a job is kept
+type CheckpointStore interface {
+	Load() (*Checkpoint, error)
+	Save(cp *Checkpoint) error
+}
+
+// FileCheckpointStore keeps checkpoint in a local json file
+type FileCheckpointStore struct {
+	Path string
+}
+
+func (f *FileCheckpointStore) Load() (*Checkpoint, error) {
+	return LoadCheckpoint(f.Path)
+}
+
+func (f *FileCheckpointStore) Save(cp *Checkpoint) error {
+	return cp.Save(f.Path)
+}
+
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint file, %s", err.Error())
+	}
+
+	cp := new(Checkpoint)
+	if err = json.Unmarshal(b, cp); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint file, %s", err.Error())
+	}
+	if cp.Config == nil {
+		return nil, fmt.Errorf("checkpoint file %s has no config", path)
+	}
+	return cp, nil
+}
+
+// Save writes checkpoint to a temp file and renames it, a crash won't leave a broken checkpoint
+func (cp *Checkpoint) Save(path string) error {
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newCheckpoint(w *Writer, c *conf.Config) *Checkpoint {
+	config := *c
+	config.Password = ""
+	config.DestPassword = ""
+	// password of dest is not saved either, it's given by `resume --dest-password`
+	if dest, err := c.DestInfo(); c.Dest != "" && err == nil {
+		config.Dest = dest.String()
+	}
+	return &Checkpoint{
+		Config:     &config,
+		Database:   w.Database,
+		Table:      w.Table,
+		SqlType:    w.SqlType,
+		ExecuteSQL: w.ExecuteSQL,
+		UniqueKey:  w.unqKeys.UniqueKeyColumns,
+		Status:     vars.JobRunning,
+	}
+}
+
+// saveCheckpoint saves the last committed key values, row counter and status of job
+func (w *Writer) saveCheckpoint(status string) error {
+	if w.checkpointStore == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	w.checkpoint.KeyValues = toCheckpointValues(w.lastKeyValues)
+	w.checkpoint.RowAffects = w.GetRowAffects()
+	w.checkpoint.UpdatedAt = time.Now()
+	w.checkpoint.Status = status
+	w.mu.Unlock()
+	return w.checkpointStore.Save(w.checkpoint)
+}
+
+// loadCheckpoint makes writer continue from the key values of the checkpoint
+func (w *Writer) loadCheckpoint() error {
+	cp, err := w.checkpointStore.Load()
+	if err != nil {
+		return err
+	}
+
+	if cp.Status == vars.JobFinished {
+		return fmt.Errorf("job in checkpoint is already finished")
+	}
+	if !reflect.DeepEqual(cp.UniqueKey, w.unqKeys.UniqueKeyColumns) {
+		return fmt.Errorf("unique key of checkpoint %v doesn't match the chosen key %v", cp.UniqueKey, w.unqKeys.UniqueKeyColumns)
+	}
+
+	w.StartKeyValues, err = w.unqKeys.parseKeyValues(cp.KeyValues)
+	if err != nil {
+		return err
+	}
+	w.lastKeyValues = w.StartKeyValues
+	w.RowAffects = cp.RowAffects
+	return nil
+}
+
+// LastKeyValues returns the key values of the last committed chunk. The job run by workers returns the last key of
+// the first unfinished worker, all rows before it are committed.
+func (w *Writer) LastKeyValues() []*KeyValue {
+	w.mu.Lock()
+	last, workers := w.lastKeyValues, w.workers
+	w.mu.Unlock()
+	for _, worker := range workers {
+		if keyValues := worker.LastKeyValues(); len(keyValues) != 0 {
+			last = keyValues
+		}
+		if !worker.finished.Load() {
+			break
+		}
+	}
+	return last
+}
+
+func (w *Writer) setLastKeyValues(keyValues []*KeyValue) {
+	w.mu.Lock()
+	w.lastKeyValues = keyValues
+	w.mu.Unlock()
+}
+
+// KeyValuesString formats key values like (col1=val1, col2=val2)
+func KeyValuesString(keyValues []*KeyValue) string {
+	values := make([]string, 0, len(keyValues))
+	for _, kv := range keyValues {
+		values = append(values, fmt.Sprintf("%s=%v", kv.ColumnName, kv.ColumnValue))
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
+
+func toCheckpointValues(keyValues []*KeyValue) []*CheckpointValue {
+	values := make([]*CheckpointValue, 0, len(keyValues))
+	for _, kv := range keyValues {
+		values = append(values, &CheckpointValue{
+			Column: kv.ColumnName,
+			Value:  fmt.Sprintf("%v", kv.ColumnValue),
+		})
+	}
+	return values
+}
+
+// parseKeyValues converts checkpoint values back to the go type of every key column
+func (u *UnqKeys) parseKeyValues(values []*CheckpointValue) ([]*KeyValue, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	if len(values) != len(u.UniqueKeyColumns) {
+		return nil, fmt.Errorf("checkpoint has %d key values, but key has %d columns", len(values), len(u.UniqueKeyColumns))
+	}
+
+	keyValues := make([]*KeyValue, 0, len(values))
+	for i, col := range u.UniqueKeyColumns {
+		raw := sql.RawBytes(values[i].Value)
+		value, err := handleColumnValue([]interface{}{&raw}, []string{col}, col, u.UniqueKeyTypes[i])
+		if err != nil {
+			return nil, err
+		}
+		keyValues = append(keyValues, &KeyValue{
+			ColumnName:  col,
+			ColumnValue: value,
+		})
+	}
+	return keyValues, nil
+}
@@ -0,0 +1,93 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/vars"
+)
+
+// TableCheckpointStore keeps checkpoint in table _goc_jobs of the source instance,
+// so that job can be resumed from any host and running jobs can be seen by sql
+type TableCheckpointStore struct {
+	MysqlClient *sql.DB
+	Database    string
+	JobId       string
+	hostname    string
+}
+
+func NewTableCheckpointStore(client *sql.DB, database, jobId string) (*TableCheckpointStore, error) {
+	hostname, _ := os.Hostname()
+	t := &TableCheckpointStore{
+		MysqlClient: client,
+		Database:    database,
+		JobId:       jobId,
+		hostname:    hostname,
+	}
+
+	_, err := client.Exec(fmt.Sprintf(vars.CreateJobTableSQL, t.Database))
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *TableCheckpointStore) Load() (*Checkpoint, error) {
+	var (
+		cp         = &Checkpoint{Config: new(conf.Config)}
+		uniqueKey  string
+		lastKey    string
+		configJson string
+		heartbeat  int64
+	)
+	err := t.MysqlClient.QueryRow(fmt.Sprintf(vars.LoadJobSQL, t.Database), t.JobId).Scan(
+		&cp.Database, &cp.Table, &cp.SqlType, &cp.ExecuteSQL, &uniqueKey, &lastKey,
+		&cp.RowAffects, &cp.Status, &configJson, &heartbeat)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("job %s doesn't exist in %s._goc_jobs", t.JobId, t.Database)
+	} else if err != nil {
+		return nil, err
+	}
+
+	cp.UpdatedAt = time.Unix(heartbeat, 0)
+	cp.UniqueKey = strings.Split(uniqueKey, ",")
+	if err = json.Unmarshal([]byte(lastKey), &cp.KeyValues); err != nil {
+		return nil, fmt.Errorf("failed to parse last_key of job %s, %s", t.JobId, err.Error())
+	}
+	if err = json.Unmarshal([]byte(configJson), cp.Config); err != nil {
+		return nil, fmt.Errorf("failed to parse config of job %s, %s", t.JobId, err.Error())
+	}
+	return cp, nil
+}
+
+// Status returns the status of job, empty if it doesn't exist
+func (t *TableCheckpointStore) Status() (string, error) {
+	var status string
+	err := t.MysqlClient.QueryRow(fmt.Sprintf(vars.JobStatusSQL, t.Database), t.JobId).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return status, err
+}
+
+func (t *TableCheckpointStore) Save(cp *Checkpoint) error {
+	lastKey, err := json.Marshal(cp.KeyValues)
+	if err != nil {
+		return err
+	}
+	configJson, err := json.Marshal(cp.Config)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.MysqlClient.Exec(fmt.Sprintf(vars.SaveJobSQL, t.Database),
+		t.JobId, cp.Database, cp.Table, cp.SqlType, cp.ExecuteSQL, strings.Join(cp.UniqueKey, ","),
+		string(lastKey), cp.RowAffects, cp.Status, t.hostname, string(configJson))
+	return err
+}
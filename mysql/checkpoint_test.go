@@ -0,0 +1,46 @@
+package mysql
+
+import (
+	"path/filepath"
+	"testing"
+
+	parser "github.com/pingcap/parser/mysql"
+
+	"go-oak-chunk/v2/conf"
+)
+
+func TestCheckpointKeyValues(t *testing.T) {
+	unqKey := &UnqKeys{
+		UniqueKeyColumns: []string{"id", "c"},
+		UniqueKeyTypes:   []byte{parser.TypeLonglong, parser.TypeVarchar},
+		IsNull:           []bool{false, false},
+	}
+	keyValues := []*KeyValue{
+		{ColumnName: "id", ColumnValue: uint64(18446744073709551615)},
+		{ColumnName: "c", ColumnValue: "abc"},
+	}
+
+	path := filepath.Join(t.TempDir(), "goc.checkpoint")
+	cp := &Checkpoint{
+		Config:    &conf.Config{ExecuteQuery: "delete from t where id > 0"},
+		UniqueKey: unqKey.UniqueKeyColumns,
+		KeyValues: toCheckpointValues(keyValues),
+	}
+	if err := cp.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := unqKey.parseKeyValues(cp.KeyValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range keyValues {
+		if parsed[i].ColumnValue != keyValues[i].ColumnValue {
+			t.Fatalf("key value of %s got %v, want %v", parsed[i].ColumnName, parsed[i].ColumnValue, keyValues[i].ColumnValue)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package mysql
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// chunkSizeFactor bounds the chunk size adjusted by chunk_time within 1/chunkSizeFactor and
+	// chunkSizeFactor times of chunk_size
+	chunkSizeFactor = 10
+	// rateWeight is the weight of the old rate in the decaying average, the same as pt-online-schema-change
+	rateWeight = 0.75
+)
+
+// newProducerQueue buffers the chunks fetched ahead of writer. With chunk_time only one chunk is buffered,
+// so that the size of the next chunk follows the latest rate of writer.
+func newProducerQueue(chunkTime time.Duration) chan *Producer {
+	if chunkTime > 0 {
+		return make(chan *Producer, 1)
+	}
+	return make(chan *Producer, 1000)
+}
+
+// observeRate updates the decaying average of chunk rows committed per second by a txn
+func (w *Writer) observeRate(rows int64, d time.Duration) {
+	if w.ChunkTime <= 0 || rows <= 0 || d <= 0 {
+		return
+	}
+	rate := float64(rows) / d.Seconds()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.rowRate == 0 {
+		w.rowRate = rate
+		return
+	}
+	w.rowRate = w.rowRate*rateWeight + rate*(1-rateWeight)
+}
+
+// RowRate returns the average chunk rows committed per second, 0 before the first commit
+func (w *Writer) RowRate() float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rowRate
+}
+
+// chunkLimit returns the rows of the next chunk which takes chunkTime at the average rate of writer.
+// It is chunk_size without chunk_time or before the first commit.
+func (p *Procedure) chunkLimit() int64 {
+	if p.chunkTime <= 0 || p.rowRate == nil {
+		return p.ChunkSize
+	}
+	rate := p.rowRate()
+	if rate <= 0 {
+		return p.ChunkSize
+	}
+	limit := int64(rate * p.chunkTime.Seconds())
+	// chunk size 1 executes chunks by a single key
+	lower := max(p.ChunkSize/chunkSizeFactor, 2)
+	return min(max(limit, lower), p.ChunkSize*chunkSizeFactor)
+}
+
+// chunkWhere returns ExecWhere with limit of the chunk, which differs from chunk_size with chunk_time.
+// It returns the limit in the where clause too.
+func (p *Procedure) chunkWhere(limit int64) (string, int64) {
+	if p.multiTable || p.chunkTime <= 0 || limit == p.ChunkSize {
+		return p.ExecWhere, p.ChunkSize
+	}
+	return limitWhere(p.rangeWhere, limit), limit
+}
+
+func limitWhere(rangeWhere string, limit int64) string {
+	return rangeWhere + " limit " + strconv.FormatInt(limit, 10)
+}
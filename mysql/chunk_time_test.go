@@ -0,0 +1,44 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChunkLimit(t *testing.T) {
+	w := &Writer{ChunkSize: 1000, ChunkTime: 500 * time.Millisecond}
+	p := &Procedure{ChunkSize: 1000, chunkTime: w.ChunkTime, rowRate: w.RowRate, rangeWhere: " AND (`id` >= ? AND `id` <= ?)"}
+	if limit := p.chunkLimit(); limit != 1000 {
+		t.Fatalf("got limit %d before the first commit", limit)
+	}
+
+	w.observeRate(4000, time.Second)
+	if limit := p.chunkLimit(); limit != 2000 {
+		t.Fatalf("got limit %d at 4000 rows/s", limit)
+	}
+	// the old rate weighs 0.75
+	w.observeRate(8000, time.Second)
+	if limit := p.chunkLimit(); limit != 2500 {
+		t.Fatalf("got limit %d at 5000 rows/s", limit)
+	}
+	if where, limit := p.chunkWhere(2500); where != " AND (`id` >= ? AND `id` <= ?) limit 2500" || limit != 2500 {
+		t.Fatalf("got chunk where %q", where)
+	}
+
+	w.observeRate(100000000, time.Second)
+	if limit := p.chunkLimit(); limit != 10000 {
+		t.Fatalf("got limit %d, expected at most 10 times of chunk size", limit)
+	}
+	w.rowRate = 1
+	if limit := p.chunkLimit(); limit != 100 {
+		t.Fatalf("got limit %d, expected at least 1/10 of chunk size", limit)
+	}
+
+	// chunk size is fixed without chunk time
+	fixed := &Writer{ChunkSize: 1000}
+	fixed.observeRate(4000, time.Second)
+	p = &Procedure{ChunkSize: 1000, rowRate: fixed.RowRate, ExecWhere: " AND (`id` >= ? AND `id` <= ?) limit 1000"}
+	if where, limit := p.chunkWhere(500); p.chunkLimit() != 1000 || where != p.ExecWhere || limit != 1000 {
+		t.Fatalf("got limit %d and where %q without chunk time", limit, where)
+	}
+}
@@ -2,11 +2,14 @@ package mysql
 
 import (
 	"database/sql"
+	"fmt"
 	"strconv"
+	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 
 	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/vars"
 )
 
 func NewMysqlClient(t *conf.Config) (*sql.DB, error) {
@@ -33,6 +36,43 @@ func NewMysqlClientForSlave(t *conf.Config, host string) (*sql.DB, error) {
 	return db, nil
 }
 
+func NewMysqlClientForDest(d *conf.Dest) (*sql.DB, error) {
+	dsn := d.User + ":" + d.Password + "@(" + d.Host + ":" + strconv.Itoa(d.Port) + ")/" + d.Database
+	dsn += "?checkConnLiveness=true"
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(5)
+	db.SetMaxIdleConns(5)
+	return db, nil
+}
+
+// GlobalStatus returns the integer values of global status variables, names must be checked by conf.ParseLoad
+func GlobalStatus(client *sql.DB, names []string) (map[string]int64, error) {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, "'"+name+"'")
+	}
+	rows, err := client.Query(fmt.Sprintf(vars.GlobalStatusSQL, strings.Join(quoted, ",")))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	status := make(map[string]int64, len(names))
+	for rows.Next() {
+		var name, value string
+		if err = rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			status[strings.ToLower(name)] = v
+		}
+	}
+	return status, rows.Err()
+}
+
 func CheckVersion(client *sql.DB) (version string, err error) {
 	err = client.QueryRow("select @@version").Scan(&version)
 	if err != nil {
@@ -40,3 +80,13 @@ func CheckVersion(client *sql.DB) (version string, err error) {
 	}
 	return version, nil
 }
+
+// noBackslashEscapes returns whether sql_mode of the sessions has NO_BACKSLASH_ESCAPES, which makes backslash
+// an ordinary char in string literals
+func noBackslashEscapes(client *sql.DB) (bool, error) {
+	var mode string
+	if err := client.QueryRow(vars.SqlModeSQL).Scan(&mode); err != nil {
+		return false, err
+	}
+	return strings.Contains(mode, "NO_BACKSLASH_ESCAPES"), nil
+}
@@ -0,0 +1,135 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/log"
+	"go-oak-chunk/v2/vars"
+)
+
+type ExplainRow struct {
+	Table string
+	Type  string
+	Key   string
+	Rows  string
+	Extra string
+}
+
+// explainCheck explains the boundary select and the stmt of the first chunk,
+// to make sure the chosen key is still used after the where clause of user is added
+func (w *Writer) explainCheck(c *conf.Config) error {
+	if c.ExplainCheck == vars.ExplainCheckOff {
+		return nil
+	}
+
+	p := NewProcedure(w)
+	if p.ChunkSize == 0 {
+		log.StreamLogger.Debug("chunk size is 0, skip explain check")
+		return nil
+	}
+
+	problems := make([]string, 0)
+	plan, err := Explain(w.MysqlClient, p.FirstSQL)
+	if err != nil {
+		return fmt.Errorf("explain boundary select got err: %v", err)
+	}
+	problems = append(problems, w.checkPlan("boundary select", plan)...)
+
+	// the chunk stmt needs real values, so take them from the first chunk
+	keyValues, _, isFinished, err := p.fetchFistAndLastData(p.FirstSQL)
+	if err != nil {
+		return fmt.Errorf("fetch first chunk for explain got err: %v", err)
+	}
+
+	if !isFinished {
+		if p.ChunkSize == 1 {
+			keyValues = keyValues[:len(w.unqKeys.UniqueKeyColumns)]
+		}
+		execSql, values := w.ExecStmt(&Producer{WhereClause: p.ExecWhere, CurrentKeyValues: keyValues})
+		plan, err = Explain(w.MysqlClient, w.BindArgs(execSql, values))
+		if err != nil {
+			return fmt.Errorf("explain %s stmt got err: %v", w.SqlType, err)
+		}
+		problems = append(problems, w.checkPlan(strings.ToLower(w.SqlType)+" stmt", plan)...)
+	} else {
+		log.StreamLogger.Debug("no rows match the where clause, skip explain of %s stmt", w.SqlType)
+	}
+
+	if len(problems) == 0 {
+		log.StreamLogger.Debug("explain check passed, key: %s", w.unqKeys.Name)
+		return nil
+	}
+
+	for _, problem := range problems {
+		log.StreamLogger.Error("[EXPLAIN CHECK] %s", problem)
+	}
+	if c.ExplainCheck == vars.ExplainCheckAbort {
+		return errors.New("explain check failed, refuse to start. Use --explain-check=warn to ignore it")
+	}
+	log.StreamLogger.Error("explain check failed, the chunk dml may scan much more rows than expected!")
+	return nil
+}
+
+// checkPlan returns problems of the plan: full scan, another key is used or filesort
+func (w *Writer) checkPlan(stmt string, plan []*ExplainRow) []string {
+	table := w.Table
+	if w.tableAlias != "" {
+		table = w.tableAlias
+	}
+
+	problems := make([]string, 0)
+	for _, row := range plan {
+		if row.Table != table {
+			continue
+		}
+
+		if row.Type == "ALL" {
+			problems = append(problems, fmt.Sprintf("%s does a full table scan on %s, rows: %s", stmt, w.Table, row.Rows))
+		}
+		if row.Key != w.unqKeys.Name {
+			problems = append(problems, fmt.Sprintf("%s uses key [%s] instead of [%s]", stmt, row.Key, w.unqKeys.Name))
+		}
+		if strings.Contains(row.Extra, "Using filesort") {
+			problems = append(problems, fmt.Sprintf("%s uses filesort", stmt))
+		}
+	}
+	return problems
+}
+
+func Explain(client *sql.DB, query string) ([]*ExplainRow, error) {
+	rows, err := client.Query(fmt.Sprintf(vars.ExplainSQL, query))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := make([]*ExplainRow, 0)
+	for rows.Next() {
+		scanArgs := make([]interface{}, len(cols))
+		for i := range scanArgs {
+			scanArgs[i] = &sql.RawBytes{}
+		}
+
+		if err = rows.Scan(scanArgs...); err != nil {
+			return nil, err
+		}
+
+		plan = append(plan, &ExplainRow{
+			Table: ColumnValue(scanArgs, cols, "table"),
+			Type:  ColumnValue(scanArgs, cols, "type"),
+			Key:   ColumnValue(scanArgs, cols, "key"),
+			Rows:  ColumnValue(scanArgs, cols, "rows"),
+			Extra: ColumnValue(scanArgs, cols, "Extra"),
+		})
+	}
+	return plan, rows.Err()
+}
@@ -22,7 +22,7 @@ func BuildSelectWhereClause(unqKeys *UnqKeys) map[string]string {
 			clause := make([]string, 0)
 			for j := 0; j <= i-1; j++ {
 				var where string
-				key := Quota + unqKeys.UniqueKeyColumns[j] + Quota
+				key := unqKeys.quoteColumn(unqKeys.UniqueKeyColumns[j])
 				if unqKeys.IsNull[j] {
 					where = fmt.Sprintf("((%s IS NULL AND %s IS NULL) OR (%s = %s))", Value, key, key, Value)
 				} else {
@@ -32,7 +32,7 @@ func BuildSelectWhereClause(unqKeys *UnqKeys) map[string]string {
 			}
 
 			var where string
-			key := Quota + col + Quota
+			key := unqKeys.quoteColumn(col)
 			isEnd := i == len(unqKeys.UniqueKeyColumns)-1
 			if unqKeys.IsNull[i] {
 				if string_utils.ContainsAny(cmp, []string{"<=", ">="}) && isEnd {
@@ -69,7 +69,7 @@ func BuildSelectWhereClause(unqKeys *UnqKeys) map[string]string {
 func BuildBulkExecWhereClause(unqKeys *UnqKeys) string {
 	clauses := make([]string, 0)
 	for i, col := range unqKeys.UniqueKeyColumns {
-		key := Quota + col + Quota
+		key := unqKeys.quoteColumn(col)
 		if unqKeys.IsNull[i] {
 			clauses = append(clauses, fmt.Sprintf("((%s IS NULL AND %s IS NULL) OR (%s = %s))", Value, key, key, Value))
 		} else {
@@ -78,3 +78,20 @@ func BuildBulkExecWhereClause(unqKeys *UnqKeys) string {
 	}
 	return " AND " + "(" + strings.Join(clauses, " AND ") + ")"
 }
+
+// quoteColumns returns the comma separated list of quoted columns
+func quoteColumns(cols []string) string {
+	quoted := make([]string, 0, len(cols))
+	for _, col := range cols {
+		quoted = append(quoted, Quota+strings.ReplaceAll(col, Quota, Quota+Quota)+Quota)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// quoteColumn quotes the key column, which is qualified by the driving table of a multi-table stmt
+func (u *UnqKeys) quoteColumn(col string) string {
+	if u.Alias != "" {
+		return Quota + u.Alias + Quota + "." + Quota + col + Quota
+	}
+	return Quota + col + Quota
+}
@@ -25,6 +25,63 @@ type SlaveHost struct {
 
 type visitor struct {
 	whereClause string
+	orderLimit  *orderLimit
+	err         error
+}
+
+// orderLimit is ORDER BY and LIMIT of user stmt, LIMIT caps the rows of all chunks
+type orderLimit struct {
+	// limit is 0 if there is no LIMIT
+	limit   int64
+	orderBy []string
+}
+
+func parseOrderLimit(order *ast.OrderByClause, limit *ast.Limit) (*orderLimit, error) {
+	ol := &orderLimit{}
+	if limit != nil {
+		if limit.Offset != nil {
+			return nil, errors.New("limit with offset is not supported")
+		}
+		count, ok := limit.Count.(ast.ValueExpr)
+		if !ok {
+			return nil, errors.New("limit must be a number")
+		}
+		switch v := count.GetValue().(type) {
+		case uint64:
+			ol.limit = int64(v)
+		case int64:
+			ol.limit = v
+		}
+		if ol.limit <= 0 {
+			return nil, errors.New("limit must be greater than 0")
+		}
+	}
+
+	if order != nil {
+		for _, item := range order.Items {
+			col, ok := item.Expr.(*ast.ColumnNameExpr)
+			if !ok || item.Desc {
+				return nil, errors.New("order by must be the columns of primary/unique key in ascending order, the same as chunks")
+			}
+			ol.orderBy = append(ol.orderBy, col.Name.Name.O)
+		}
+	}
+	return ol, nil
+}
+
+// matchKey returns whether rows are in the order of orderBy when walking the key
+func (o *orderLimit) matchKey(keyColumns []string) bool {
+	n := len(o.orderBy)
+	if len(keyColumns) < n {
+		// columns after unique key don't change the order
+		n = len(keyColumns)
+	}
+	for i := 0; i < n; i++ {
+		if !strings.EqualFold(o.orderBy[i], keyColumns[i]) {
+			return false
+		}
+	}
+	return true
 }
 
 func (v *visitor) Enter(in ast.Node) (out ast.Node, skipChildren bool) {
@@ -34,31 +91,178 @@ func (v *visitor) Enter(in ast.Node) (out ast.Node, skipChildren bool) {
 func (v *visitor) Leave(in ast.Node) (out ast.Node, ok bool) {
 	switch x := in.(type) {
 	case *ast.UpdateStmt:
-		buf := new(strings.Builder)
 		if x.Where != nil {
-			x.Where.Restore(&format.RestoreCtx{
-				Flags: format.DefaultRestoreFlags,
-				In:    buf,
-			})
-		}
-		s := strings.ReplaceAll(buf.String(), "_UTF8MB4", "")
-		s = strings.ReplaceAll(s, "_UTF8", "")
-		v.whereClause = s
+			v.whereClause = restoreNode(x.Where)
+		}
+		v.orderLimit, v.err = parseOrderLimit(x.Order, x.Limit)
 	case *ast.DeleteStmt:
-		buf := new(strings.Builder)
 		if x.Where != nil {
-			x.Where.Restore(&format.RestoreCtx{
-				Flags: format.DefaultRestoreFlags,
-				In:    buf,
-			})
+			v.whereClause = restoreNode(x.Where)
 		}
-		s := strings.ReplaceAll(buf.String(), "_UTF8MB4", "")
-		s = strings.ReplaceAll(s, "_UTF8", "")
-		v.whereClause = s
+		v.orderLimit, v.err = parseOrderLimit(x.Order, x.Limit)
 	}
 	return in, true
 }
 
+// updateColumns returns the columns assigned by SET of single-table update, without duplicates
+func updateColumns(stmt *ast.UpdateStmt) []string {
+	columns := make([]string, 0, len(stmt.List))
+	for _, assignment := range stmt.List {
+		name := assignment.Column.Name.O
+		duplicate := false
+		for _, col := range columns {
+			if strings.EqualFold(col, name) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			columns = append(columns, name)
+		}
+	}
+	return columns
+}
+
+// setDiffCondition matches the rows which would still be changed by SET of update, used to verify the update
+func setDiffCondition(list []*ast.Assignment) string {
+	equals := make([]string, 0, len(list))
+	for _, assignment := range list {
+		equals = append(equals, fmt.Sprintf("%s<=>%s", restoreNode(assignment.Column), restoreNode(assignment.Expr)))
+	}
+	return fmt.Sprintf("NOT (%s)", strings.Join(equals, " AND "))
+}
+
+// nonDeterministicFuncs return a new value on every call, SET by them can't be compared after the update
+var nonDeterministicFuncs = map[string]bool{
+	ast.Now: true, ast.CurrentTimestamp: true, ast.LocalTime: true, ast.LocalTimestamp: true, ast.Sysdate: true,
+	ast.Curdate: true, ast.CurrentDate: true, ast.Curtime: true, ast.CurrentTime: true,
+	ast.UTCDate: true, ast.UTCTime: true, ast.UTCTimestamp: true, ast.UnixTimestamp: true,
+	ast.Rand: true, ast.UUID: true, ast.UUIDShort: true, ast.ConnectionID: true, ast.LastInsertId: true, ast.Sleep: true,
+}
+
+// setVerifiable returns an error if SET of update can't be verified by setDiffCondition: the expr reads a column of
+// the updated table, ex: cnt = cnt + 1 is still different from cnt after the update, or it isn't deterministic.
+func setVerifiable(list []*ast.Assignment) error {
+	// columns of single-table update aren't qualified, any column in the expr is of the updated table
+	updated := make(map[string]bool)
+	for _, assignment := range list {
+		updated[assignment.Column.Table.L] = true
+	}
+	for _, assignment := range list {
+		v := &setExprVisitor{updated: updated}
+		assignment.Expr.Accept(v)
+		if v.err != nil {
+			return fmt.Errorf("verify can't check `%s`, %v", restoreNode(assignment), v.err)
+		}
+	}
+	return nil
+}
+
+type setExprVisitor struct {
+	updated map[string]bool
+	err     error
+}
+
+func (v *setExprVisitor) Enter(in ast.Node) (ast.Node, bool) {
+	switch x := in.(type) {
+	case *ast.ColumnNameExpr:
+		// unqualified column of multi-table update may be of the updated table too
+		if v.updated[""] || x.Name.Table.L == "" || v.updated[x.Name.Table.L] {
+			v.err = fmt.Errorf("it reads column %s of the updated table", restoreNode(x))
+		}
+	case *ast.FuncCallExpr:
+		if nonDeterministicFuncs[x.FnName.L] {
+			v.err = fmt.Errorf("%s() isn't deterministic", x.FnName.L)
+		}
+	}
+	return in, v.err != nil
+}
+
+func (v *setExprVisitor) Leave(in ast.Node) (ast.Node, bool) {
+	return in, true
+}
+
+// restoreNode restores node to sql text without charset prefix of string literal
+func restoreNode(node ast.Node) string {
+	buf := new(strings.Builder)
+	_ = node.Restore(&format.RestoreCtx{
+		Flags: format.DefaultRestoreFlags,
+		In:    buf,
+	})
+	s := strings.ReplaceAll(buf.String(), "_UTF8MB4", "")
+	s = strings.ReplaceAll(s, "_UTF8", "")
+	return s
+}
+
+// insertSelect is `INSERT/REPLACE INTO dst SELECT ... FROM src WHERE ...` split into parts,
+// so that the range condition of every chunk can be added after the where clause
+type insertSelect struct {
+	// prefix is the stmt without where clause and `ON DUPLICATE KEY UPDATE`
+	prefix      string
+	whereClause string
+	// suffix is `ON DUPLICATE KEY UPDATE ...` if exists
+	suffix     string
+	fromClause string
+	database   string
+	table      string
+	alias      string
+	orderLimit *orderLimit
+}
+
+func parseInsertSelect(stmt *ast.InsertStmt) (*insertSelect, error) {
+	sel, ok := stmt.Select.(*ast.SelectStmt)
+	if !ok {
+		return nil, errors.New("only `insert/replace ... select` with a single select is supported")
+	}
+	switch {
+	case sel.From == nil:
+		return nil, errors.New("select of insert must have a from clause")
+	case sel.Where == nil:
+		return nil, errors.New("select of insert must contain where clause")
+	case sel.GroupBy != nil, sel.Having != nil, sel.Distinct:
+		return nil, errors.New("group by, having or distinct in select of insert can't be chunked")
+	case sel.From.TableRefs.Right != nil:
+		return nil, errors.New("join in select of insert is not supported")
+	}
+
+	source, ok := sel.From.TableRefs.Left.(*ast.TableSource)
+	if !ok {
+		return nil, errors.New("select of insert must select from a table")
+	}
+	table, ok := source.Source.(*ast.TableName)
+	if !ok {
+		return nil, errors.New("select of insert must select from a table, not a subquery")
+	}
+
+	ol, err := parseOrderLimit(sel.OrderBy, sel.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	is := &insertSelect{
+		orderLimit:  ol,
+		whereClause: restoreNode(sel.Where),
+		fromClause:  restoreNode(sel.From),
+		database:    table.Schema.O,
+		table:       table.Name.O,
+		alias:       source.AsName.O,
+	}
+	if len(stmt.OnDuplicate) != 0 {
+		assignments := make([]string, len(stmt.OnDuplicate))
+		for i, assignment := range stmt.OnDuplicate {
+			assignments[i] = restoreNode(assignment)
+		}
+		is.suffix = " ON DUPLICATE KEY UPDATE " + strings.Join(assignments, ",")
+	}
+
+	// restore the stmt without where, order by, limit and `ON DUPLICATE KEY UPDATE`, then put them back
+	where, orderBy, limit, onDuplicate := sel.Where, sel.OrderBy, sel.Limit, stmt.OnDuplicate
+	sel.Where, sel.OrderBy, sel.Limit, stmt.OnDuplicate = nil, nil, nil, nil
+	is.prefix = restoreNode(stmt)
+	sel.Where, sel.OrderBy, sel.Limit, stmt.OnDuplicate = where, orderBy, limit, onDuplicate
+	return is, nil
+}
+
 func columnIndex(slaveCols []string, colName string) int {
 	for idx := range slaveCols {
 		if slaveCols[idx] == colName {
@@ -114,6 +318,24 @@ func ColumnValueUInt64(scanArgs []interface{}, slaveCols []string, colName strin
 	return i, nil
 }
 
+// storedColumns returns the columns of table which can be written, generated columns are computed by the table
+func storedColumns(table *ast.CreateTableStmt) []string {
+	cols := make([]string, 0, len(table.Cols))
+	for _, col := range table.Cols {
+		generated := false
+		for _, option := range col.Options {
+			if option.Tp == ast.ColumnOptionGenerated {
+				generated = true
+				break
+			}
+		}
+		if !generated {
+			cols = append(cols, col.Name.Name.String())
+		}
+	}
+	return cols
+}
+
 func GetPossibleUniqueKeys(tableNode *ast.CreateTableStmt) []*UnqKeys {
 	unqKeys := make([]*UnqKeys, 0)
 	for _, constraint := range tableNode.Constraints {
@@ -123,7 +345,13 @@ func GetPossibleUniqueKeys(tableNode *ast.CreateTableStmt) []*UnqKeys {
 			continue
 		}
 
+		name := constraint.Name
+		if constraint.Tp == ast.ConstraintPrimaryKey {
+			name = "PRIMARY"
+		}
+
 		unqKey := &UnqKeys{
+			Name:             name,
 			UniqueKeyColumns: make([]string, 0),
 			CountColumns:     0,
 			UniqueKeyTypes:   make([]byte, 0),
@@ -196,6 +424,151 @@ func handleColumnValue(scanArgs []interface{}, cols []string, keyCol string, tp
 	}
 }
 
+// joinTable is a table in the join of a multi-table stmt
+type joinTable struct {
+	database string
+	table    string
+	alias    string
+}
+
+// name is how the table is referred to in the stmt
+func (t *joinTable) name() string {
+	if t.alias != "" {
+		return t.alias
+	}
+	return t.table
+}
+
+// multiTable is a multi-table `update/delete` split into parts, it's chunked on the key of driving table
+type multiTable struct {
+	// prefix is the stmt without where clause
+	prefix      string
+	whereClause string
+	// fromClause is the join, which is used in boundary select
+	fromClause string
+	driving    *joinTable
+}
+
+// isMultiTable returns whether stmt is a `delete/update` with join
+func isMultiTable(node ast.StmtNode) bool {
+	switch x := node.(type) {
+	case *ast.DeleteStmt:
+		return x.IsMultiTable
+	case *ast.UpdateStmt:
+		return x.TableRefs.TableRefs.Right != nil
+	}
+	return false
+}
+
+// parseMultiTable picks the driving table from the join, which is the only target of delete or the leftmost table
+// if driving is empty
+func parseMultiTable(node ast.StmtNode, driving string) (*multiTable, error) {
+	var (
+		refs    *ast.TableRefsClause
+		where   ast.ExprNode
+		targets []string
+	)
+	switch x := node.(type) {
+	case *ast.DeleteStmt:
+		if x.Order != nil || x.Limit != nil {
+			return nil, errors.New("order by or limit is not allowed in multi-table delete")
+		}
+		refs, where = x.TableRefs, x.Where
+		for _, t := range x.Tables.Tables {
+			targets = append(targets, t.Name.O)
+		}
+	case *ast.UpdateStmt:
+		if x.Order != nil || x.Limit != nil {
+			return nil, errors.New("order by or limit is not allowed in multi-table update")
+		}
+		refs, where = x.TableRefs, x.Where
+	default:
+		return nil, errors.New("only `update/delete` can be multi-table")
+	}
+	if where == nil {
+		return nil, errors.New("multi-table stmt must contain where clause")
+	}
+
+	tables := make([]*joinTable, 0)
+	collectTables(refs.TableRefs, &tables)
+	if len(tables) == 0 {
+		return nil, errors.New("can't find any table in the join")
+	}
+
+	if driving == "" {
+		driving = tables[0].name()
+		if len(targets) == 1 {
+			driving = targets[0]
+		}
+	}
+	var dt *joinTable
+	for _, t := range tables {
+		if t.name() != driving {
+			continue
+		}
+		if dt != nil {
+			return nil, fmt.Errorf("driving table %s is ambiguous, use its alias", driving)
+		}
+		dt = t
+	}
+	if dt == nil {
+		return nil, fmt.Errorf("driving table %s is not in the join", driving)
+	}
+
+	mt := &multiTable{
+		whereClause: restoreNode(where),
+		fromClause:  restoreNode(refs),
+		driving:     dt,
+	}
+	// restore the stmt without where, then put it back
+	switch x := node.(type) {
+	case *ast.DeleteStmt:
+		x.Where = nil
+		mt.prefix = restoreNode(x)
+		x.Where = where
+	case *ast.UpdateStmt:
+		x.Where = nil
+		mt.prefix = restoreNode(x)
+		x.Where = where
+	}
+	return mt, nil
+}
+
+// collectTables collects the tables of join from left to right, subquery can't be driving table and is skipped
+func collectTables(node ast.ResultSetNode, tables *[]*joinTable) {
+	switch x := node.(type) {
+	case *ast.Join:
+		collectTables(x.Left, tables)
+		if x.Right != nil {
+			collectTables(x.Right, tables)
+		}
+	case *ast.TableSource:
+		if t, ok := x.Source.(*ast.TableName); ok {
+			*tables = append(*tables, &joinTable{database: t.Schema.O, table: t.Name.O, alias: x.AsName.O})
+		}
+	}
+}
+
+// DrivingTable returns the table which is chunked on, it's the driving table if stmt is multi-table
+func DrivingTable(sql, driving string) (string, error) {
+	tree, err := soar.TiParse(sql, "", "")
+	if err != nil {
+		return "", err
+	}
+	if len(tree) == 0 || !isMultiTable(tree[0]) {
+		if driving != "" {
+			return "", errors.New("driving_table only works with multi-table `update/delete`")
+		}
+		return TableMetaInfo(sql)
+	}
+
+	mt, err := parseMultiTable(tree[0], driving)
+	if err != nil {
+		return "", err
+	}
+	return mt.driving.table, nil
+}
+
 func TableMetaInfo(sql string) (string, error) {
 	tree, err := soar.TiParse(sql, "", "")
 	if err != nil {
@@ -205,6 +578,15 @@ func TableMetaInfo(sql string) (string, error) {
 	jsonString := soar.StmtNode2JSON(sql, "", "")
 
 	node := tree[0]
+	// chunk on the source table of `insert ... select`
+	if ins, ok := node.(*ast.InsertStmt); ok && ins.Select != nil {
+		is, err := parseInsertSelect(ins)
+		if err != nil {
+			return "", err
+		}
+		return is.table, nil
+	}
+
 	switch node.(type) {
 	// SetOprStmt represents "union/except/intersect statement"
 	case *ast.InsertStmt, *ast.UpdateStmt, *ast.DeleteStmt:
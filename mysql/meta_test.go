@@ -0,0 +1,227 @@
+package mysql
+
+import (
+	"strings"
+	"testing"
+
+	soar "github.com/XiaoMi/soar/ast"
+	"github.com/pingcap/parser/ast"
+)
+
+func TestParseInsertSelect(t *testing.T) {
+	query := "insert into dst (a,b) select a, b from src s where s.c < '2024-01-01' on duplicate key update b=values(b)"
+	table, err := TableMetaInfo(query)
+	if err != nil || table != "src" {
+		t.Fatalf("table of insert select should be src, got: %s, err: %v", table, err)
+	}
+
+	stmts, err := soar.TiParse(query, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	is, err := parseInsertSelect(stmts[0].(*ast.InsertStmt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if is.orderLimit == nil || is.orderLimit.limit != 0 || len(is.orderLimit.orderBy) != 0 {
+		t.Fatalf("insert select has no order by or limit, got: %+v", is.orderLimit)
+	}
+	is.orderLimit = nil
+	expected := &insertSelect{
+		prefix:      "INSERT INTO `dst` (`a`,`b`) SELECT `a`,`b` FROM `src` AS `s`",
+		whereClause: "`s`.`c`<'2024-01-01'",
+		suffix:      " ON DUPLICATE KEY UPDATE `b`=VALUES(`b`)",
+		fromClause:  "`src` AS `s`",
+		table:       "src",
+		alias:       "s",
+	}
+	if *is != *expected {
+		t.Fatalf("got: %+v, expected: %+v", is, expected)
+	}
+
+	for _, query = range []string{
+		"insert into dst values (1, 2)",
+		"insert into dst select * from src",
+		"insert into dst select c, count(*) from src where c > 1 group by c",
+		"insert into dst select * from src join src2 on src.id = src2.id where c > 1",
+		"insert into dst select * from (select * from src) t where c > 1",
+	} {
+		stmts, err = soar.TiParse(query, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = parseInsertSelect(stmts[0].(*ast.InsertStmt)); err == nil {
+			t.Fatalf("%s should be rejected", query)
+		}
+	}
+}
+
+func TestParseMultiTable(t *testing.T) {
+	cases := []struct {
+		query    string
+		driving  string
+		expected *multiTable
+	}{
+		{
+			query: "DELETE t FROM t JOIN parent p ON t.pid = p.id WHERE p.status = 'closed'",
+			expected: &multiTable{
+				prefix:      "DELETE `t` FROM `t` JOIN `parent` AS `p` ON `t`.`pid`=`p`.`id`",
+				whereClause: "`p`.`status`='closed'",
+				fromClause:  "`t` JOIN `parent` AS `p` ON `t`.`pid`=`p`.`id`",
+				driving:     &joinTable{table: "t"},
+			},
+		},
+		{
+			query:   "UPDATE t1 a JOIN lookup l ON a.k = l.k SET a.x = l.y WHERE l.y > 0",
+			driving: "a",
+			expected: &multiTable{
+				prefix:      "UPDATE `t1` AS `a` JOIN `lookup` AS `l` ON `a`.`k`=`l`.`k` SET `a`.`x`=`l`.`y`",
+				whereClause: "`l`.`y`>0",
+				fromClause:  "`t1` AS `a` JOIN `lookup` AS `l` ON `a`.`k`=`l`.`k`",
+				driving:     &joinTable{table: "t1", alias: "a"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		stmts, err := soar.TiParse(c.query, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isMultiTable(stmts[0]) {
+			t.Fatalf("%s should be multi-table", c.query)
+		}
+		mt, err := parseMultiTable(stmts[0], c.driving)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mt.prefix != c.expected.prefix || mt.whereClause != c.expected.whereClause ||
+			mt.fromClause != c.expected.fromClause || *mt.driving != *c.expected.driving {
+			t.Fatalf("%s got: %+v %+v", c.query, mt, mt.driving)
+		}
+	}
+
+	table, err := DrivingTable("UPDATE t1 a JOIN lookup l ON a.k = l.k SET a.x = l.y WHERE l.y > 0", "l")
+	if err != nil || table != "lookup" {
+		t.Fatalf("driving table should be lookup, got: %s, err: %v", table, err)
+	}
+	if _, err = DrivingTable("UPDATE t1 a JOIN lookup l ON a.k = l.k SET a.x = l.y WHERE l.y > 0", "t2"); err == nil {
+		t.Fatal("driving table which is not in join should be rejected")
+	}
+	if _, err = DrivingTable("DELETE FROM t1 WHERE id > 0", "t1"); err == nil {
+		t.Fatal("driving table of single-table stmt should be rejected")
+	}
+}
+
+func TestParseOrderLimit(t *testing.T) {
+	cases := map[string]*orderLimit{
+		"delete from t1 where c < 5":                                               {},
+		"delete from t1 where c < 5 limit 5000000":                                 {limit: 5000000},
+		"update t1 set k = 1 where c < 5 order by id limit 10":                     {limit: 10, orderBy: []string{"id"}},
+		"insert into dst select * from src where c < 5 order by src.a, b limit 10": {limit: 10, orderBy: []string{"a", "b"}},
+	}
+	for query, expected := range cases {
+		stmts, err := soar.TiParse(query, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ol *orderLimit
+		if ins, ok := stmts[0].(*ast.InsertStmt); ok {
+			is, err := parseInsertSelect(ins)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ol = is.orderLimit
+		} else {
+			v := &visitor{}
+			stmts[0].Accept(v)
+			if v.err != nil {
+				t.Fatal(v.err)
+			}
+			ol = v.orderLimit
+		}
+		if ol.limit != expected.limit || strings.Join(ol.orderBy, ",") != strings.Join(expected.orderBy, ",") {
+			t.Fatalf("%s got: %+v, expected: %+v", query, ol, expected)
+		}
+	}
+
+	for _, query := range []string{
+		"delete from t1 where c < 5 order by id desc limit 10",
+		"delete from t1 where c < 5 order by id + 1",
+		"delete from t1 where c < 5 limit 0",
+	} {
+		stmts, err := soar.TiParse(query, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := &visitor{}
+		stmts[0].Accept(v)
+		if v.err == nil {
+			t.Fatalf("%s should be rejected", query)
+		}
+	}
+
+	ol := &orderLimit{orderBy: []string{"a", "b"}}
+	if !ol.matchKey([]string{"a", "b", "c"}) || !ol.matchKey([]string{"a"}) || ol.matchKey([]string{"b", "a"}) {
+		t.Fatal("matchKey is wrong")
+	}
+}
+
+func TestUpdateColumns(t *testing.T) {
+	stmts, err := soar.TiParse("update t set name = 'a', cnt = cnt + 1, NAME = concat(name, 'b') where id < 100", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := updateColumns(stmts[0].(*ast.UpdateStmt))
+	if strings.Join(columns, ",") != "name,cnt" {
+		t.Fatalf("got: %v", columns)
+	}
+}
+
+func TestStoredColumns(t *testing.T) {
+	stmts, err := soar.TiParse("CREATE TABLE `t` (`id` int NOT NULL, `a` int, `b` int GENERATED ALWAYS AS (`a` + 1) VIRTUAL, "+
+		"`c` int AS (`a` * 2) STORED, `d` datetime DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY (`id`))", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := storedColumns(stmts[0].(*ast.CreateTableStmt))
+	if quoteColumns(columns) != "`id`, `a`, `d`" {
+		t.Fatalf("got: %v", columns)
+	}
+}
+
+func TestSetDiffCondition(t *testing.T) {
+	cases := map[string]string{
+		"update t set name = 'a', cnt = 1 where id < 100":                         "NOT (`name`<=>'a' AND `cnt`<=>1)",
+		"update t join l on t.lid = l.id set t.x = l.y where l.status = 'closed'": "NOT (`t`.`x`<=>`l`.`y`)",
+	}
+	for query, expected := range cases {
+		stmts, err := soar.TiParse(query, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cond := setDiffCondition(stmts[0].(*ast.UpdateStmt).List); cond != expected {
+			t.Fatalf("got: %s, expected: %s", cond, expected)
+		}
+		if err = setVerifiable(stmts[0].(*ast.UpdateStmt).List); err != nil {
+			t.Fatalf("%s got err: %v", query, err)
+		}
+	}
+
+	// these rows are still different from SET after the update
+	for _, query := range []string{
+		"update t set name = 'a', cnt = cnt + 1 where id < 100",
+		"update t set updated_at = now() where id < 100",
+		"update t set token = concat('t', uuid()) where id < 100",
+		"update t join l on t.lid = l.id set t.x = t.x + l.y where l.status = 'closed'",
+		"update t join l on t.lid = l.id set t.x = y where l.status = 'closed'",
+	} {
+		stmts, err := soar.TiParse(query, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = setVerifiable(stmts[0].(*ast.UpdateStmt).List); err == nil {
+			t.Fatalf("%s should not be verified", query)
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"go-oak-chunk/v2/log"
 	"go-oak-chunk/v2/vars"
@@ -13,47 +15,94 @@ import (
 type Procedure struct {
 	MysqlClient       *sql.DB
 	ChunkSize         int64
+	FirstSQL          string
+	NextSQL           string
+	ExecWhere         string
 	originWhereClause string
 	database          string
 	table             string
+	fromClause        string
+	multiTable        bool
 	unqKeys           *UnqKeys
+	startKeyValues    []*KeyValue
+	keyColumns        string
+	firstBase         string
+	nextBase          string
+	// rangeWhere is ExecWhere without limit
+	rangeWhere string
+	// chunkTime is the target time of a chunk, the limit of chunks follows rowRate of writer if it's set
+	chunkTime time.Duration
+	rowRate   func() float64
+	// rowLimit is LIMIT of user stmt, produced is rows of chunks sent.
+	// affected is rows affected by the writer which the chunks are executed by, see LimitByWriter
+	rowLimit int64
+	produced int64
+	affected func() int64
 }
 
 type KeyValue struct {
-	ColumnName  string
-	ColumnValue any
+	ColumnName  string `json:"column"`
+	ColumnValue any    `json:"value"`
 }
 
 func NewProcedure(w *Writer) *Procedure {
-	return &Procedure{
+	p := &Procedure{
 		MysqlClient:       w.MysqlClient,
 		ChunkSize:         w.ChunkSize,
 		originWhereClause: w.OriginWhereClause,
 		database:          w.Database,
 		table:             w.Table,
+		fromClause:        w.fromClause,
+		multiTable:        w.multiTable,
 		unqKeys:           w.unqKeys,
+		startKeyValues:    w.StartKeyValues,
+		rowLimit:          w.RowLimit,
+		produced:          w.RowAffects,
+		chunkTime:         w.ChunkTime,
+		rowRate:           w.RowRate,
 	}
+	p.buildStmt()
+	return p
 }
 
-func (p *Procedure) BuildSQL(producer chan *Producer, wg *sync.WaitGroup) error {
+// NewVerifyProcedure walks the whole key range again with VerifyWhereClause of writer,
+// from the first key and without LIMIT of user stmt
+func NewVerifyProcedure(w *Writer) *Procedure {
+	p := &Procedure{
+		MysqlClient:       w.MysqlClient,
+		ChunkSize:         w.ChunkSize,
+		originWhereClause: w.VerifyWhereClause(),
+		database:          w.Database,
+		table:             w.Table,
+		fromClause:        w.fromClause,
+		multiTable:        w.multiTable,
+		unqKeys:           w.unqKeys,
+	}
+	p.buildStmt()
+	return p
+}
+
+// buildStmt builds the select stmts used to walk the index and the where clause used to execute every chunk
+func (p *Procedure) buildStmt() {
 	if p.ChunkSize == 0 {
-		pr := &Producer{
-			WhereClause:      "",
-			IsFinished:       true,
-			CurrentKeyValues: make([]*KeyValue, 0),
-		}
-		producer <- pr
-		wg.Done()
-		return nil
+		return
 	}
 
 	// build select stmt
 	keyList := getKeyList(p.unqKeys)
-	keyColumns := strings.Join(keyList, ",")
+	p.keyColumns = strings.Join(keyList, ",")
 	conditions := BuildSelectWhereClause(p.unqKeys)
 
-	firstSql := fmt.Sprintf(vars.FirstSQL, keyColumns, p.database+"."+p.table, p.originWhereClause)
-	nextSql := firstSql
+	from := p.database + "." + p.table
+	if p.fromClause != "" {
+		from = p.fromClause
+	}
+	selectColumns := p.keyColumns
+	if p.multiTable {
+		// a row of driving table may join many rows
+		selectColumns = "DISTINCT " + p.keyColumns
+	}
+	p.firstBase = fmt.Sprintf(vars.FirstSQL, selectColumns, from, p.originWhereClause)
 	/*
 		if p.ChunkSize > 1 {
 			nextSql += fmt.Sprintf(" AND %s ", conditions[">"])
@@ -61,122 +110,152 @@ func (p *Procedure) BuildSQL(producer chan *Producer, wg *sync.WaitGroup) error
 			nextSql += fmt.Sprintf(" AND %s ", conditions[">="])
 		}
 	*/
-	nextSql += fmt.Sprintf(" AND %s ", conditions[">"])
-	firstSql += fmt.Sprintf(" ORDER BY %s LIMIT %d ", keyColumns, p.ChunkSize)
-	if p.ChunkSize > 1 {
-		nextSql += fmt.Sprintf(" ORDER BY %s LIMIT %d ", keyColumns, p.ChunkSize)
-	} else {
-		nextSql += fmt.Sprintf(" ORDER BY %s LIMIT %d ", keyColumns, 1000)
-	}
+	p.nextBase = p.firstBase + fmt.Sprintf(" AND %s ", conditions[">"])
 
 	// build execute stmt
 	var execWhere string
 	if p.ChunkSize == 1 {
 		// index can't be not unique
 		execWhere = BuildBulkExecWhereClause(p.unqKeys)
+	} else if p.multiTable {
+		// multi-table update/delete can't have limit, the range of chunk is enough
+		execWhere = fmt.Sprintf(" AND (%s AND %s)", conditions[">="], conditions["<="])
 	} else {
-		execWhere = fmt.Sprintf(" AND (%s AND %s) limit %d", conditions[">="], conditions["<="], p.ChunkSize)
+		p.rangeWhere = fmt.Sprintf(" AND (%s AND %s)", conditions[">="], conditions["<="])
+		execWhere = fmt.Sprintf("%s limit %d", p.rangeWhere, p.ChunkSize)
 	}
 
-	log.StreamLogger.Debug("firstSql: [%s]", firstSql)
-	log.StreamLogger.Debug("nextSql: [%s]", nextSql)
-	// prepare is finished
-	// --------------------------------------
-	// start select index value(s)
-	// note: chunkSize == 1 or chunkSize > 1
-	fetchSql := firstSql
-	selectKeyCols := make([]*KeyValue, 0, len(p.unqKeys.UniqueKeyColumns))
-	for {
-		if fetchSql == firstSql {
-			if p.ChunkSize > 1 {
-				keyValues, isFinished, err := p.fetchFistAndLastData(fetchSql)
-				if err != nil {
-					log.StreamLogger.Error("BuildSQL got err: %v", err)
-					return err
-				}
+	p.FirstSQL = p.fetchStmt(true, p.ChunkSize)
+	p.NextSQL = p.fetchStmt(false, p.nextLimit())
+	p.ExecWhere = execWhere
+}
 
-				pr := &Producer{
-					WhereClause:      execWhere,
-					IsFinished:       isFinished,
-					CurrentKeyValues: keyValues,
-				}
-				producer <- pr
-				if isFinished {
-					wg.Done()
-					return nil
-				}
+// fetchStmt returns the boundary select which fetches at most limit rows
+func (p *Procedure) fetchStmt(first bool, limit int64) string {
+	base := p.nextBase
+	if first {
+		base = p.firstBase
+	}
+	return base + fmt.Sprintf(" ORDER BY %s LIMIT %d ", p.keyColumns, limit)
+}
 
-				fetchSql = nextSql
-				selectKeyCols = keyValues[len(keyValues)-len(p.unqKeys.UniqueKeyColumns):]
-				continue
-			} else { // if p.ChunkSize == 1
-				rows, err := p.MysqlClient.Query(fetchSql)
-				if err != nil {
-					log.StreamLogger.Error("BuildSQL got err: %v", err)
-					return err
-				}
+// nextLimit is the limit of boundary select after the first one
+func (p *Procedure) nextLimit() int64 {
+	if p.ChunkSize > 1 {
+		return p.chunkLimit()
+	}
+	return 1000
+}
 
-				cols, err := rows.Columns()
-				if err != nil {
-					log.StreamLogger.Error("BuildSQL got err: %v", err)
-					return err
-				}
+// LimitByWriter makes LIMIT of user stmt cap the rows affected by w instead of the rows of chunks sent,
+// they differ when rows are changed concurrently. Reader stops once the rows affected reach LIMIT,
+// and w skips the chunks fetched ahead.
+func (p *Procedure) LimitByWriter(w *Writer) {
+	p.affected = w.GetRowAffects
+}
 
-				keyValues := make([]*KeyValue, 0, len(p.unqKeys.UniqueKeyColumns))
-				for rows.Next() {
-					keyValues, err = p.getSingleData(cols, rows)
-					if err != nil {
-						log.StreamLogger.Error("BuildSQL got err: %v", err)
-						return err
-					}
-
-					pr := &Producer{
-						WhereClause:      execWhere,
-						IsFinished:       false,
-						CurrentKeyValues: keyValues,
-					}
-					producer <- pr
-				}
+// rowsLeft returns the rows left of LIMIT in user stmt
+func (p *Procedure) rowsLeft() int64 {
+	if p.affected != nil {
+		return p.rowLimit - p.affected()
+	}
+	return p.rowLimit - p.produced
+}
 
-				if len(keyValues) == 0 {
-					log.StreamLogger.Debug("fetch index data is finished")
-					pr := &Producer{
-						WhereClause:      execWhere,
-						IsFinished:       true,
-						CurrentKeyValues: keyValues,
-					}
-					producer <- pr
-					wg.Done()
-					return nil
-				}
+// capLimit caps the limit of boundary select by the rows left of LIMIT in user stmt
+func (p *Procedure) capLimit(limit int64) int64 {
+	if left := p.rowsLeft(); p.rowLimit > 0 && left < limit {
+		return max(left, 1)
+	}
+	return limit
+}
 
-				fetchSql = nextSql
-				selectKeyCols = keyValues
-				rows.Close()
-				continue
+func (p *Procedure) BuildSQL(ctx context.Context, producer chan *Producer, wg *sync.WaitGroup) error {
+	// the stmt isn't chunked, all rows are changed by one operation as the only chunk
+	if p.ChunkSize == 0 {
+		for _, pr := range []*Producer{
+			{CurrentKeyValues: make([]*KeyValue, 0)},
+			{IsFinished: true, CurrentKeyValues: make([]*KeyValue, 0)},
+		} {
+			if err := sendProducer(ctx, producer, pr); err != nil {
+				return err
 			}
 		}
+		wg.Done()
+		return nil
+	}
+
+	execWhere := p.ExecWhere
+
+	log.StreamLogger.Debug("firstSql: [%s]", p.FirstSQL)
+	log.StreamLogger.Debug("nextSql: [%s]", p.NextSQL)
+	// prepare is finished
+	// --------------------------------------
+	// start select index value(s)
+	// note: chunkSize == 1 or chunkSize > 1
+	first := true
+	selectKeyCols := make([]*KeyValue, 0, len(p.unqKeys.UniqueKeyColumns))
+	if len(p.startKeyValues) != 0 {
+		// continue from checkpoint
+		first = false
+		selectKeyCols = p.startKeyValues
+	}
+	for {
+		if p.rowLimit > 0 && p.rowsLeft() <= 0 {
+			log.StreamLogger.Debug("row limit %d is reached", p.rowLimit)
+			pr := &Producer{
+				WhereClause:      execWhere,
+				IsFinished:       true,
+				CurrentKeyValues: make([]*KeyValue, 0),
+			}
+			if err := sendProducer(ctx, producer, pr); err != nil {
+				return err
+			}
+			wg.Done()
+			return nil
+		}
+
+		var (
+			fetchSql string
+			args     []any
+			limit    int64
+		)
+		if first {
+			limit = p.capLimit(p.ChunkSize)
+			fetchSql = p.fetchStmt(true, limit)
+		} else {
+			limit = p.capLimit(p.nextLimit())
+			fetchSql = p.fetchStmt(false, limit)
+			args = getArgs(selectKeyCols)
+		}
+		first = false
 
-		args := getArgs(selectKeyCols)
 		//log.StreamLogger.Debug("Args values: %v", args)
 		if p.ChunkSize > 1 {
-			keyValues, isFinished, err := p.fetchFistAndLastData(fetchSql, args...)
+			keyValues, rowCount, isFinished, err := p.fetchFistAndLastData(fetchSql, args...)
 			if err != nil {
 				log.StreamLogger.Error("BuildSQL got err: %v", err)
 				return err
 			}
 
+			where, whereLimit := p.chunkWhere(limit)
 			pr := &Producer{
-				WhereClause:      execWhere,
+				WhereClause:      where,
 				IsFinished:       isFinished,
 				CurrentKeyValues: keyValues,
+				Rows:             rowCount,
+				rangeWhere:       p.rangeWhere,
+				limit:            whereLimit,
+			}
+			if err := sendProducer(ctx, producer, pr); err != nil {
+				return err
 			}
-			producer <- pr
 			if isFinished {
 				wg.Done()
 				return nil
 			}
 
+			p.produced += rowCount
 			selectKeyCols = keyValues[len(keyValues)-len(p.unqKeys.UniqueKeyColumns):]
 		} else { // if p.ChunkSize == 1
 			//log.StreamLogger.Debug("fetchSql: %s", fetchSql)
@@ -188,6 +267,7 @@ func (p *Procedure) BuildSQL(producer chan *Producer, wg *sync.WaitGroup) error
 
 			cols, err := rows.Columns()
 			if err != nil {
+				rows.Close()
 				log.StreamLogger.Error("BuildSQL got err: %v", err)
 				return err
 			}
@@ -196,6 +276,7 @@ func (p *Procedure) BuildSQL(producer chan *Producer, wg *sync.WaitGroup) error
 			for rows.Next() {
 				keyValues, err = p.getSingleData(cols, rows)
 				if err != nil {
+					rows.Close()
 					log.StreamLogger.Error("BuildSQL got err: %v", err)
 					return err
 				}
@@ -204,8 +285,13 @@ func (p *Procedure) BuildSQL(producer chan *Producer, wg *sync.WaitGroup) error
 					WhereClause:      execWhere,
 					IsFinished:       false,
 					CurrentKeyValues: keyValues,
+					Rows:             1,
+				}
+				if err := sendProducer(ctx, producer, pr); err != nil {
+					rows.Close()
+					return err
 				}
-				producer <- pr
+				p.produced++
 			}
 			rows.Close()
 
@@ -216,7 +302,9 @@ func (p *Procedure) BuildSQL(producer chan *Producer, wg *sync.WaitGroup) error
 					IsFinished:       true,
 					CurrentKeyValues: keyValues,
 				}
-				producer <- pr
+				if err := sendProducer(ctx, producer, pr); err != nil {
+					return err
+				}
 				wg.Done()
 				return nil
 			}
@@ -226,7 +314,71 @@ func (p *Procedure) BuildSQL(producer chan *Producer, wg *sync.WaitGroup) error
 	}
 }
 
-func (p *Procedure) fetchFistAndLastData(fetchSql string, args ...any) ([]*KeyValue, bool, error) {
+// CountRows walks the key the same way as BuildSQL, and returns the number of rows the chunks cover
+func (p *Procedure) CountRows(ctx context.Context) (int64, error) {
+	if p.ChunkSize == 0 {
+		from := p.database + "." + p.table
+		if p.fromClause != "" {
+			from = p.fromClause
+		}
+		var count int64
+		err := p.MysqlClient.QueryRowContext(ctx, fmt.Sprintf(vars.CountSQL, from, p.originWhereClause)).Scan(&count)
+		if p.rowLimit > 0 && count > p.rowLimit {
+			count = p.rowLimit
+		}
+		return count, err
+	}
+
+	var count int64
+	err := p.Walk(ctx, func(pr *Producer) {
+		count += pr.Rows
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Walk runs BuildSQL and calls fn with every chunk, without the finished one
+func (p *Procedure) Walk(ctx context.Context, fn func(pr *Producer)) error {
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	producer := make(chan *Producer, 1000)
+	errChan := make(chan error, 1)
+	wg.Add(1)
+	go func() {
+		errChan <- p.BuildSQL(ctx, producer, &wg)
+	}()
+
+	for {
+		select {
+		case err := <-errChan:
+			if err != nil {
+				return err
+			}
+		case pr := <-producer:
+			if pr.IsFinished {
+				return nil
+			}
+			fn(pr)
+		}
+	}
+}
+
+// sendProducer stops waiting for a free slot of producer chan once ctx is done
+func sendProducer(ctx context.Context, producer chan *Producer, pr *Producer) error {
+	select {
+	case producer <- pr:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fetchFistAndLastData returns the first and last key values of the chunk and how many rows the chunk covers
+func (p *Procedure) fetchFistAndLastData(fetchSql string, args ...any) ([]*KeyValue, int64, bool, error) {
+	var rowCount int64
 	resKeyValues := make([]*KeyValue, 0)
 	lastKeyValues := make([]*KeyValue, 0)
 	//log.StreamLogger.Debug("fetchSql: %s", fetchSql)
@@ -234,16 +386,17 @@ func (p *Procedure) fetchFistAndLastData(fetchSql string, args ...any) ([]*KeyVa
 	defer rows.Close()
 	if err != nil {
 		log.StreamLogger.Error("fetchFistAndLastData got err: %v", err)
-		return nil, false, err
+		return nil, 0, false, err
 	}
 
 	cols, err := rows.Columns()
 	if err != nil {
 		log.StreamLogger.Error("fetchFistAndLastData got err: %v", err)
-		return nil, false, err
+		return nil, 0, false, err
 	}
 
 	for rows.Next() {
+		rowCount++
 		// todo: how to handle null value
 		scanArgs := make([]interface{}, len(cols))
 		for i := range scanArgs {
@@ -252,7 +405,7 @@ func (p *Procedure) fetchFistAndLastData(fetchSql string, args ...any) ([]*KeyVa
 
 		if err = rows.Scan(scanArgs...); err != nil {
 			log.StreamLogger.Error("fetchFistAndLastData Scan got err: %v", err)
-			return nil, false, err
+			return nil, 0, false, err
 		}
 
 		// first row
@@ -260,7 +413,7 @@ func (p *Procedure) fetchFistAndLastData(fetchSql string, args ...any) ([]*KeyVa
 			for i, keyCol := range p.unqKeys.UniqueKeyColumns {
 				value, err := handleColumnValue(scanArgs, cols, keyCol, p.unqKeys.UniqueKeyTypes[i])
 				if err != nil {
-					return nil, false, err
+					return nil, 0, false, err
 				}
 				keyValue := &KeyValue{
 					ColumnName:  keyCol,
@@ -275,7 +428,7 @@ func (p *Procedure) fetchFistAndLastData(fetchSql string, args ...any) ([]*KeyVa
 		for i, keyCol := range p.unqKeys.UniqueKeyColumns {
 			value, err := handleColumnValue(scanArgs, cols, keyCol, p.unqKeys.UniqueKeyTypes[i])
 			if err != nil {
-				return nil, false, err
+				return nil, 0, false, err
 			}
 			keyValue := &KeyValue{
 				ColumnName:  keyCol,
@@ -294,9 +447,9 @@ func (p *Procedure) fetchFistAndLastData(fetchSql string, args ...any) ([]*KeyVa
 	// 最后一次的情况
 	if len(resKeyValues) == 0 {
 		// empty set
-		return nil, true, nil
+		return nil, 0, true, nil
 	}
-	return append(resKeyValues, lastKeyValues...), false, nil
+	return append(resKeyValues, lastKeyValues...), rowCount, false, nil
 }
 
 func (p *Procedure) getSingleData(cols []string, rows *sql.Rows) ([]*KeyValue, error) {
@@ -377,7 +530,7 @@ func getArgs(keyValues []*KeyValue) []any {
 func getKeyList(unqKeys *UnqKeys) []string {
 	keys := make([]string, 0, len(unqKeys.UniqueKeyColumns))
 	for _, column := range unqKeys.UniqueKeyColumns {
-		keys = append(keys, "`"+column+"`")
+		keys = append(keys, unqKeys.quoteColumn(column))
 	}
 	return keys
 }
@@ -1,10 +1,13 @@
 package mysql
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"sync"
 	"testing"
+
+	"go-oak-chunk/v2/conf"
 )
 
 func TestBuildSQL(t *testing.T) {
@@ -15,14 +18,17 @@ func TestBuildSQL(t *testing.T) {
 	}
 	config.PreCheck()
 
-	writer := NewWriter(config)
+	writer, err := NewWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
 	p := NewProcedure(writer)
 	var wg sync.WaitGroup
 	errChan := make(chan error)
 
 	wg.Add(1)
 	go func() {
-		errChan <- p.BuildSQL(writer.ProducerQueue, &wg)
+		errChan <- p.BuildSQL(context.Background(), writer.ProducerQueue, &wg)
 	}()
 
 	// wait task done: create doneChan to wait doneWg done
@@ -60,3 +66,24 @@ func TestBuildSQL(t *testing.T) {
 	}
 
 }
+
+func TestUnchunkedSQL(t *testing.T) {
+	// chunk_size 0 changes all rows by one chunk without key values
+	p := &Procedure{}
+	queue := make(chan *Producer, 2)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	if err := p.BuildSQL(context.Background(), queue, &wg); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	w := &Writer{ExecuteSQL: "DELETE FROM `t1` WHERE (id < 10)"}
+	pr := <-queue
+	if execSql, values := w.ExecStmt(pr); pr.IsFinished || execSql != w.ExecuteSQL || len(values) != 0 {
+		t.Fatalf("got chunk %+v, stmt %s, values %v", pr, execSql, values)
+	}
+	if pr = <-queue; !pr.IsFinished {
+		t.Fatal("the only chunk should be followed by the finished one")
+	}
+}
@@ -0,0 +1,95 @@
+package mysql
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RunStats is counted by writer for the report of the run
+type RunStats struct {
+	// StartKey is the first key of the first committed chunk in this run
+	StartKey []*KeyValue
+	Txns     int64
+	// Retries is the number of chunks executed again after an error
+	Retries int64
+	// Throttled is the time writer waited for tokens, keyed by throttle state
+	Throttled map[string]time.Duration
+	// MaxSlaveLag is the max slave lag seen while running, -1 if slaves are not checked
+	MaxSlaveLag int64
+	// ChunkLatencies are sorted execution times of the committed chunks
+	ChunkLatencies []time.Duration
+}
+
+type runStats struct {
+	mu          sync.Mutex
+	startKey    []*KeyValue
+	txns        int64
+	retries     int64
+	throttled   map[string]time.Duration
+	maxSlaveLag int64
+	latencies   []time.Duration
+}
+
+func newRunStats() *runStats {
+	return &runStats{
+		throttled:   make(map[string]time.Duration),
+		maxSlaveLag: -1,
+	}
+}
+
+func (s *runStats) addThrottle(state string, d time.Duration) {
+	if d <= 0 || state == "" {
+		return
+	}
+	s.mu.Lock()
+	s.throttled[state] += d
+	s.mu.Unlock()
+}
+
+func (s *runStats) addRetry() {
+	s.mu.Lock()
+	s.retries++
+	s.mu.Unlock()
+}
+
+// commit records the chunks of a committed txn
+func (s *runStats) commit(startKey []*KeyValue, latencies []time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.txns++
+	if s.startKey == nil && len(startKey) != 0 {
+		s.startKey = startKey
+	}
+	s.latencies = append(s.latencies, latencies...)
+}
+
+// ObserveSlaveLag records the max slave lag seen by lag checker
+func (w *Writer) ObserveSlaveLag(lag int64) {
+	w.stats.mu.Lock()
+	if lag > w.stats.maxSlaveLag {
+		w.stats.maxSlaveLag = lag
+	}
+	w.stats.mu.Unlock()
+}
+
+// RunStats returns a copy of the counters of this run
+func (w *Writer) RunStats() *RunStats {
+	s := w.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rs := &RunStats{
+		StartKey:       s.startKey,
+		Txns:           s.txns,
+		Retries:        s.retries,
+		Throttled:      make(map[string]time.Duration, len(s.throttled)),
+		MaxSlaveLag:    s.maxSlaveLag,
+		ChunkLatencies: append([]time.Duration(nil), s.latencies...),
+	}
+	for state, d := range s.throttled {
+		rs.Throttled[state] = d
+	}
+	sort.Slice(rs.ChunkLatencies, func(i, j int) bool { return rs.ChunkLatencies[i] < rs.ChunkLatencies[j] })
+	return rs
+}
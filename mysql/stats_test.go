@@ -0,0 +1,34 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/juju/ratelimit"
+
+	"go-oak-chunk/v2/vars"
+)
+
+func TestThrottleWait(t *testing.T) {
+	w := &Writer{stats: newRunStats()}
+	w.SetThrottle(vars.ThrottleLag)
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		w.SetThrottle(vars.ThrottleMaxLag)
+	}()
+
+	bucket := ratelimit.NewBucketWithQuantum(time.Millisecond, 1, 1)
+	if err := w.throttleWait(context.Background(), bucket, 400); err != nil {
+		t.Fatal(err)
+	}
+
+	throttled := w.RunStats().Throttled
+	lag, maxLag := throttled[vars.ThrottleLag], throttled[vars.ThrottleMaxLag]
+	if lag < 100*time.Millisecond || maxLag < 100*time.Millisecond {
+		t.Fatalf("wait across the change of state should be split, got lag %v, max-lag %v", lag, maxLag)
+	}
+	if total := lag + maxLag; total < 350*time.Millisecond || total > time.Second {
+		t.Fatalf("got throttled %v in total", total)
+	}
+}
@@ -0,0 +1,208 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	parser "github.com/pingcap/parser/mysql"
+
+	"go-oak-chunk/v2/vars"
+)
+
+// NewWorker returns a writer of the key range matched by cond, which is walked by its own Procedure in parallel with
+// the other workers of w. It shares the connection pool, key and stmt of w, and counts rows, chunks and run stats
+// into w, so that progress, report and max_affected_rows are of the whole job.
+func (w *Writer) NewWorker(cond string) *Writer {
+	worker := &Writer{
+		MysqlClient:       w.MysqlClient,
+		ExecuteSQL:        w.ExecuteSQL,
+		OriginWhereClause: fmt.Sprintf("%s AND %s", w.OriginWhereClause, cond),
+		ChunkSize:         w.ChunkSize,
+		ChunkTime:         w.ChunkTime,
+		TxnSize:           w.GetTxnSize(),
+		SqlType:           w.SqlType,
+		StartTime:         time.Now(),
+		CostTime:          1 * time.Second,
+		Database:          w.Database,
+		Table:             w.Table,
+		noLogBing:         w.noLogBing,
+		unqKeys:           w.unqKeys,
+		ProducerQueue:     newProducerQueue(w.ChunkTime),
+		multiTable:        w.multiTable,
+		fromClause:        w.fromClause,
+		tableAlias:        w.tableAlias,
+		execSuffix:        w.execSuffix,
+		setColumns:        w.setColumns,
+		verifyCondition:   w.verifyCondition,
+		stats:             w.stats,
+		parent:            w,
+		windows:           w.windows,
+	}
+	w.mu.Lock()
+	w.workers = append(w.workers, worker)
+	w.mu.Unlock()
+	return worker
+}
+
+// SplitKeyRange counts the rows matching the where clause, and splits them into at most n conditions of about count/n
+// rows by the leading key column, so that sparse or skewed ids don't leave most rows to one worker. Every bound is
+// the value count/n rows after the previous one, stepping through the key costs about one scan of the rows.
+// The first and last conditions are open, so that the rows written out of the range while running are still covered.
+// It returns nil if the matching rows can't be split.
+func (w *Writer) SplitKeyRange(n int) ([]string, error) {
+	col := w.unqKeys.quoteColumn(w.unqKeys.UniqueKeyColumns[0])
+	from := w.Database + "." + w.Table
+	if w.fromClause != "" {
+		from = w.fromClause
+	}
+	var count int64
+	if err := w.MysqlClient.QueryRow(fmt.Sprintf(vars.CountSQL, from, w.OriginWhereClause)).Scan(&count); err != nil {
+		return nil, err
+	}
+	step, n := splitStep(count, n)
+	if step == 0 {
+		return nil, nil
+	}
+
+	var prev int64
+	err := w.MysqlClient.QueryRow(fmt.Sprintf(vars.KeyFirstSQL, col, from, w.OriginWhereClause, col)).Scan(&prev)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the values after prev are counted, a value shared by several rows of a composite key is a bound only once
+	bounds := make([]int64, 0, n-1)
+	for i := 1; i < n; i++ {
+		err = w.MysqlClient.QueryRow(fmt.Sprintf(vars.KeyStepSQL, col, from, w.OriginWhereClause, col, col, step-1), prev).Scan(&prev)
+		// rows are deleted after count
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		bounds = append(bounds, prev)
+	}
+	if len(bounds) == 0 {
+		return nil, nil
+	}
+
+	conds := make([]string, 0, len(bounds)+1)
+	for i := 0; i <= len(bounds); i++ {
+		switch i {
+		case 0:
+			conds = append(conds, fmt.Sprintf("%s < %d", col, bounds[i]))
+		case len(bounds):
+			conds = append(conds, fmt.Sprintf("%s >= %d", col, bounds[i-1]))
+		default:
+			conds = append(conds, fmt.Sprintf("%s >= %d AND %s < %d", col, bounds[i-1], col, bounds[i]))
+		}
+	}
+	return conds, nil
+}
+
+// splitStep returns the rows of every range when count rows are split into n ranges, and n which is reduced
+// if there are less than n rows. step is 0 if the rows can't be split.
+func splitStep(count int64, n int) (int64, int) {
+	if int64(n) > count {
+		n = int(count)
+	}
+	if n <= 1 {
+		return 0, n
+	}
+	return count / int64(n), n
+}
+
+func isIntegerType(tp byte) bool {
+	switch tp {
+	case parser.TypeTiny, parser.TypeShort, parser.TypeLong, parser.TypeInt24, parser.TypeLonglong:
+		return true
+	}
+	return false
+}
+
+// reserveAffects adds the rows affected by a txn to the job before it's committed, and fails if MaxAffectedRows
+// would be exceeded. The rows are given back by releaseAffects if the txn isn't committed.
+func (w *Writer) reserveAffects(n int64) error {
+	job := w.job()
+	for {
+		affects := atomic.LoadInt64(&job.RowAffects)
+		if job.MaxAffectedRows > 0 && affects+n > job.MaxAffectedRows {
+			return fmt.Errorf("rows affected %d will exceed max affected rows %d, txn is rollback",
+				affects+n, job.MaxAffectedRows)
+		}
+		if job.RowLimit > 0 && affects+n > job.RowLimit {
+			return fmt.Errorf("rows affected %d will exceed LIMIT %d, txn is rollback", affects+n, job.RowLimit)
+		}
+		if atomic.CompareAndSwapInt64(&job.RowAffects, affects, affects+n) {
+			return nil
+		}
+	}
+}
+
+func (w *Writer) releaseAffects(n int64) {
+	atomic.AddInt64(&w.job().RowAffects, -n)
+}
+
+// GetRowAffects returns the rows affected of the job, which are counted by its writer or workers while they commit
+func (w *Writer) GetRowAffects() int64 {
+	return atomic.LoadInt64(&w.job().RowAffects)
+}
+
+// GetChunks returns the chunks committed by the job
+func (w *Writer) GetChunks() int64 {
+	return atomic.LoadInt64(&w.job().Chunks)
+}
+
+// GetChunkRows returns the rows of the chunks committed by the job, counted when their boundaries were fetched
+func (w *Writer) GetChunkRows() int64 {
+	return atomic.LoadInt64(&w.job().ChunkRows)
+}
+
+// GetCostTime returns the time of the last txn of writer, the job run by workers has the last txn of any worker
+func (w *Writer) GetCostTime() time.Duration {
+	return time.Duration(atomic.LoadInt64((*int64)(&w.CostTime)))
+}
+
+func (w *Writer) setCostTime(d time.Duration) {
+	atomic.StoreInt64((*int64)(&w.CostTime), int64(d))
+}
+
+// skipChunks discards the chunks fetched ahead after LIMIT of user stmt is reached, until reader sees it and finishes
+func (w *Writer) skipChunks(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case pr := <-w.ProducerQueue:
+			if pr.IsFinished {
+				return
+			}
+		}
+	}
+}
+
+// addCommitted adds the chunks of a committed txn to writer, and to its job if it's a worker
+func (w *Writer) addCommitted(chunks, chunkRows int64) {
+	atomic.AddInt64(&w.Chunks, chunks)
+	atomic.AddInt64(&w.ChunkRows, chunkRows)
+	if w.parent == nil {
+		return
+	}
+	atomic.AddInt64(&w.parent.Chunks, chunks)
+	atomic.AddInt64(&w.parent.ChunkRows, chunkRows)
+}
+
+// job returns the writer which counts the rows of the whole job
+func (w *Writer) job() *Writer {
+	if w.parent != nil {
+		return w.parent
+	}
+	return w
+}
@@ -0,0 +1,127 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"go-oak-chunk/v2/vars"
+)
+
+func TestSplitStep(t *testing.T) {
+	cases := []struct {
+		count  int64
+		n      int
+		step   int64
+		ranges int
+	}{
+		{100, 4, 25, 4},
+		{10, 3, 3, 3},
+		{2, 5, 1, 2},
+		{1, 4, 0, 1},
+		{100, 1, 0, 1},
+		{0, 4, 0, 0},
+	}
+	for _, c := range cases {
+		if step, n := splitStep(c.count, c.n); step != c.step || n != c.ranges {
+			t.Fatalf("splitStep(%d, %d) = %d, %d, expected %d, %d", c.count, c.n, step, n, c.step, c.ranges)
+		}
+	}
+}
+
+func TestReserveAffects(t *testing.T) {
+	job := &Writer{MaxAffectedRows: 100}
+	worker := &Writer{parent: job}
+
+	if err := worker.reserveAffects(60); err != nil {
+		t.Fatal(err)
+	}
+	if err := job.reserveAffects(50); err == nil {
+		t.Fatal("rows of workers should be counted in max affected rows of job")
+	}
+	worker.releaseAffects(60)
+	if err := job.reserveAffects(50); err != nil || job.RowAffects != 50 || worker.RowAffects != 0 {
+		t.Fatalf("got err %v, job rows %d, worker rows %d", err, job.RowAffects, worker.RowAffects)
+	}
+
+	worker.addCommitted(2, 80)
+	if job.Chunks != 2 || job.ChunkRows != 80 {
+		t.Fatalf("got chunks %d and chunk rows %d of job", job.Chunks, job.ChunkRows)
+	}
+}
+
+func TestWorkerProgress(t *testing.T) {
+	job := &Writer{unqKeys: &UnqKeys{UniqueKeyColumns: []string{"id"}}, stats: newRunStats()}
+	first, second := job.NewWorker("`id` < 100"), job.NewWorker("`id` >= 100")
+	if job.LastKeyValues() != nil {
+		t.Fatal("job without committed chunks should have no last key")
+	}
+
+	first.setLastKeyValues([]*KeyValue{{ColumnName: "id", ColumnValue: 5}})
+	second.setLastKeyValues([]*KeyValue{{ColumnName: "id", ColumnValue: 150}})
+	second.countCommitted(3, 90, 2*time.Second, nil, nil)
+	if v := job.LastKeyValues()[0].ColumnValue; v != 5 {
+		t.Fatalf("got last key %v, expected the one of the first unfinished worker", v)
+	}
+	first.finished.Store(true)
+	if v := job.LastKeyValues()[0].ColumnValue; v != 150 {
+		t.Fatalf("got last key %v after the first worker finished", v)
+	}
+	if job.GetChunks() != 3 || first.GetChunkRows() != 90 || job.GetCostTime() != 2*time.Second {
+		t.Fatalf("got chunks %d, chunk rows %d, last txn %v of job", job.GetChunks(), job.GetChunkRows(), job.GetCostTime())
+	}
+}
+
+func TestWorkerControl(t *testing.T) {
+	job := &Writer{TxnSize: 100}
+	worker := &Writer{parent: job}
+
+	// throttle set by getStopTime of worker is seen by throttleWait of worker and status of job
+	worker.SetThrottle(vars.ThrottleLag)
+	if worker.Throttle() != vars.ThrottleLag || job.Throttle() != vars.ThrottleLag {
+		t.Fatalf("got throttle %q of worker, %q of job", worker.Throttle(), job.Throttle())
+	}
+	worker.SetTxnSize(10)
+	if job.GetTxnSize() != 10 || worker.GetTxnSize() != 10 {
+		t.Fatalf("got txn size %d of job", job.GetTxnSize())
+	}
+	worker.Pause()
+	if !job.IsPaused() {
+		t.Fatal("pause of worker should pause the job")
+	}
+	job.Resume()
+	if worker.IsPaused() {
+		t.Fatal("resume of job should resume the worker")
+	}
+}
+
+func TestRowLimit(t *testing.T) {
+	w := &Writer{RowLimit: 100, RowAffects: 90}
+	if err := w.reserveAffects(20); err == nil {
+		t.Fatal("rows affected over LIMIT should be rejected")
+	}
+	if err := w.reserveAffects(10); err != nil {
+		t.Fatal(err)
+	}
+
+	pr := &Producer{WhereClause: " AND (`id` >= ? AND `id` <= ?) limit 1000", rangeWhere: " AND (`id` >= ? AND `id` <= ?)", limit: 1000}
+	if capped := pr.capRows(30); capped.WhereClause != " AND (`id` >= ? AND `id` <= ?) limit 30" || pr.limit != 1000 {
+		t.Fatalf("got where %q of capped chunk", capped.WhereClause)
+	}
+	if capped := pr.capRows(2000); capped != pr {
+		t.Fatal("chunk within the rows left should not be changed")
+	}
+	// multi-table chunk has no limit
+	multi := &Producer{WhereClause: " AND (`o`.`id` >= ? AND `o`.`id` <= ?)"}
+	if capped := multi.capRows(30); capped != multi {
+		t.Fatal("chunk without limit should not be changed")
+	}
+
+	p := &Procedure{rowLimit: 100, produced: 10}
+	if limit := p.capLimit(1000); limit != 90 {
+		t.Fatalf("got limit %d by rows of chunks sent", limit)
+	}
+	p.LimitByWriter(w)
+	if p.rowsLeft() != 0 || p.capLimit(1000) != 1 {
+		t.Fatalf("got rows left %d by rows affected of writer", p.rowsLeft())
+	}
+}
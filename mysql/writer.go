@@ -1,22 +1,26 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"os"
 	"reflect"
 	"regexp"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	soar "github.com/XiaoMi/soar/ast"
 	"github.com/juju/ratelimit"
 	"github.com/pingcap/parser/ast"
 
+	"go-oak-chunk/v2/archive"
 	"go-oak-chunk/v2/conf"
 	"go-oak-chunk/v2/log"
+	"go-oak-chunk/v2/utils"
 	"go-oak-chunk/v2/vars"
 )
 
@@ -25,19 +29,77 @@ type Writer struct {
 	ExecuteSQL        string
 	OriginWhereClause string
 	ChunkSize         int64
+	ChunkTime         time.Duration
 	TxnSize           int64
 	IsFinished        bool
 	SqlType           string
 	RowAffects        int64
+	ChunkRows         int64
+	Chunks            int64
+	StartTime         time.Time
 	CostTime          time.Duration
 	Database          string
 	Table             string
 	noLogBing         bool
 	unqKeys           *UnqKeys
 	ProducerQueue     chan *Producer
+
+	// RowLimit is LIMIT of user stmt, which caps the rows of all chunks, 0 means no limit
+	RowLimit int64
+	// PreCount is rows counted before writing, job is aborted when rows affected exceed MaxAffectedRows
+	PreCount        int64
+	MaxAffectedRows int64
+
+	// StartKeyValues is not empty when job continues from a checkpoint
+	StartKeyValues  []*KeyValue
+	lastKeyValues   []*KeyValue
+	checkpointStore CheckpointStore
+	checkpoint      *Checkpoint
+	mu              sync.Mutex
+	paused          int32
+	throttle        string
+	// rowRate is the decaying average of chunk rows committed per second, used by ChunkTime
+	rowRate float64
+
+	// fromClause and tableAlias are set when the chunked table is the source of `insert ... select`
+	// or the driving table of multi-table stmt
+	multiTable bool
+	fromClause string
+	tableAlias string
+	// execSuffix is added after the where clause of every chunk, e.g. `ON DUPLICATE KEY UPDATE ...`
+	execSuffix string
+
+	// rows of every chunk are archived in the same txn before they are deleted, by the columns which aren't generated
+	archiver   archive.Archiver
+	archiveSQL string
+	columns    []string
+	// before-image of every chunk is written to undo log in the same txn, setColumns are the SET columns of update
+	undo       archive.Archiver
+	undoSQL    string
+	setColumns []string
+	// verifyCondition matches updated rows which are still different from SET
+	verifyCondition string
+	// verifyErr is why the update can't be verified, SET reads the updated table or isn't deterministic
+	verifyErr error
+
+	// stats is counted for the report of the run
+	stats *runStats
+	// parent is the writer of the job if it's a worker, which counts rows and is paused for all workers
+	parent *Writer
+	// workers of the job in the order of their ranges, the last key of the job is theirs
+	workers []*Writer
+	// finished is IsFinished set after the last txn is committed, it's read by the job while workers are running
+	finished atomic.Bool
+	// noBackslashEscapes is NO_BACKSLASH_ESCAPES in sql_mode of the sessions, values are quoted by it when they are bound
+	noBackslashEscapes bool
+	// new txns are started only in the maintenance windows, nil means always
+	windows *conf.Windows
 }
 
 type UnqKeys struct {
+	Name string
+	// Alias qualifies the key columns when the stmt is multi-table
+	Alias            string
 	UniqueKeyColumns []string
 	CountColumns     int
 	UniqueKeyTypes   []byte
@@ -49,6 +111,22 @@ type Producer struct {
 	WhereClause      string
 	IsFinished       bool
 	CurrentKeyValues []*KeyValue
+	// Rows is the number of rows this chunk covered when its boundaries were fetched
+	Rows int64
+	// rangeWhere is WhereClause without limit, which is set for single-table chunks with limit
+	rangeWhere string
+	limit      int64
+}
+
+// capRows returns pr whose stmt affects at most n rows, the limit of single-table chunk is lowered to n
+func (pr *Producer) capRows(n int64) *Producer {
+	if pr.rangeWhere == "" || pr.limit <= n {
+		return pr
+	}
+	capped := *pr
+	capped.WhereClause = limitWhere(pr.rangeWhere, n)
+	capped.limit = n
+	return &capped
 }
 
 type Proceed struct {
@@ -58,58 +136,224 @@ type Proceed struct {
 	IsFinished  bool
 }
 
-func NewWriter(c *conf.Config) *Writer {
+// NewWriter checks the stmt and options of c against the table, nothing is written before Open.
+// The connections opened by the check are closed if it fails.
+func NewWriter(c *conf.Config) (*Writer, error) {
 	w := &Writer{
 		noLogBing:     c.NoLogBin,
 		ChunkSize:     c.ChunkSize,
+		ChunkTime:     c.ChunkTime,
 		TxnSize:       c.TxnSize,
 		ExecuteSQL:    strings.ReplaceAll(c.ExecuteQuery, ";", ""),
-		ProducerQueue: make(chan *Producer, 1000),
+		ProducerQueue: newProducerQueue(c.ChunkTime),
 		IsFinished:    false,
+		StartTime:     time.Now(),
 		CostTime:      1 * time.Second,
+		stats:         newRunStats(),
+	}
+	if err := w.preCheck(c); err != nil {
+		w.CloseArchiver()
+		if w.MysqlClient != nil {
+			_ = w.MysqlClient.Close()
+		}
+		return nil, err
 	}
-	w.preCheck(c)
-	return w
+	return w, nil
 }
 
-func (w *Writer) preCheck(c *conf.Config) {
+func (w *Writer) preCheck(c *conf.Config) error {
 	var err error
 
 	// 获取database和table
 	//w.Table = c.Table
 	w.Database = c.Database
 	if w.Database == "" {
-		log.StreamLogger.Error("No Database/Table specified. Specify Table with -t or --Table and Database with -d or --Database")
-		os.Exit(1)
+		return errors.New("No Database/Table specified. Specify Table with -t or --Table and Database with -d or --Database")
 	}
 
-	w.Table, err = TableMetaInfo(w.ExecuteSQL)
+	w.Table, err = DrivingTable(w.ExecuteSQL, c.DrivingTable)
 	if err != nil {
-		log.StreamLogger.Error("Table failed. %s", err.Error())
-		os.Exit(1)
+		return fmt.Errorf("Table failed. %s", err.Error())
 	}
 
 	// init mysql connect
 	w.MysqlClient, err = NewMysqlClient(c)
 	if err != nil {
-		log.StreamLogger.Error("open connect is failed, err: %+v", err)
-		os.Exit(1)
+		return fmt.Errorf("open connect is failed, err: %+v", err)
 	}
 
-	if !w.tableExists() {
-		log.StreamLogger.Error("Table %s.%s does not exist", w.Database, w.Table)
-		os.Exit(1)
+	exists, err := w.tableExists()
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("Table %s.%s does not exist", w.Database, w.Table)
 	}
 
 	err = w.getInfoFromTable(c)
 	if err != nil {
-		log.StreamLogger.Error("sql parser is failed,please check whether sql is correct, err: %+v", err)
-		os.Exit(1)
+		return fmt.Errorf("sql parser is failed,please check whether sql is correct, err: %+v", err)
+	}
+	if w.multiTable {
+		w.unqKeys.Alias = w.tableAlias
+	}
+
+	if w.noBackslashEscapes, err = noBackslashEscapes(w.MysqlClient); err != nil {
+		return fmt.Errorf("get sql_mode is failed, err: %v", err)
+	}
+	if err = w.explainCheck(c); err != nil {
+		return err
+	}
+
+	w.windows, err = conf.ParseWindows(c.Windows, c.TimeZone)
+	if err != nil {
+		return err
+	}
+
+	// the unchunked stmt is executed without LIMIT, which is the cap of all chunks
+	if w.ChunkSize == 0 && w.RowLimit > 0 {
+		return errors.New("LIMIT caps the rows of chunks, chunk_size must not be 0")
+	}
+
+	if c.Workers > 1 {
+		if w.RowLimit > 0 {
+			return errors.New("workers can't be used with LIMIT, the rows of every range can't be capped")
+		}
+		if !isIntegerType(w.unqKeys.UniqueKeyTypes[0]) {
+			return fmt.Errorf("workers split the range of leading key column %s, it must be an integer", w.unqKeys.UniqueKeyColumns[0])
+		}
+	}
+
+	if c.Verify && w.SqlType != "Delete" && w.SqlType != "Update" {
+		return errors.New("verify only works with `update` and `delete`")
+	}
+	if c.Verify && w.verifyErr != nil {
+		return w.verifyErr
+	}
+	// the walk of verify isn't capped, rerun would change the rows out of LIMIT
+	if c.VerifyRerun && w.RowLimit > 0 {
+		return errors.New("verify_rerun can't be used with LIMIT, the residual rows out of LIMIT would be changed")
+	}
+
+	// nothing will be written in dry run, include checkpoint
+	if c.DryRun {
+		return nil
+	}
+
+	if c.ArchiveFile != "" || c.Dest != "" {
+		if w.SqlType != "Delete" || w.multiTable {
+			return errors.New("archive_file and dest only work with single-table `delete`")
+		}
+		w.archiveSQL = fmt.Sprintf(vars.ArchiveSelectSQL, quoteColumns(w.columns), w.Table) + w.OriginWhereClause
+		// dest is connected to check the table, it leaves nothing if job isn't confirmed
+		if c.Dest != "" {
+			if w.archiver, err = w.newDestArchiver(c); err != nil {
+				return fmt.Errorf("open dest is failed, err: %v", err)
+			}
+		}
+	}
+
+	if c.UndoFile != "" {
+		if err = w.prepareUndo(); err != nil {
+			return fmt.Errorf("prepare undo log is failed, err: %v", err)
+		}
+	}
+
+	// the key values and rows affected of checkpoint are needed by pre-count
+	if c.Resume {
+		if w.checkpointStore, err = w.newCheckpointStore(c); err != nil {
+			return fmt.Errorf("open checkpoint is failed, err: %v", err)
+		}
+		err = w.loadCheckpoint()
+		if err != nil {
+			return fmt.Errorf("resume from checkpoint is failed, err: %v", err)
+		}
+		log.StreamLogger.Debug("resume from key values: %v, row affects: %d", getColumnValueOld(w.StartKeyValues), w.RowAffects)
+	}
+	return nil
+}
+
+// NewReplayWriter returns a writer of client which only counts and throttles the txns replayed by `goc undo`,
+// they wait by WaitTxn as Write does
+func NewReplayWriter(client *sql.DB, c *conf.Config) (*Writer, error) {
+	windows, err := conf.ParseWindows(c.Windows, c.TimeZone)
+	if err != nil {
+		return nil, err
 	}
+	return &Writer{
+		MysqlClient: client,
+		TxnSize:     c.TxnSize,
+		SqlType:     "Undo",
+		StartTime:   time.Now(),
+		CostTime:    1 * time.Second,
+		stats:       newRunStats(),
+		windows:     windows,
+	}, nil
 }
 
-func (w *Writer) Write(bucket *ratelimit.Bucket, bucketNum chan int64, wg *sync.WaitGroup) error {
-	maxRetry := 3
+// CommitReplay counts a txn replayed by `goc undo`, the cost of it is the sleep of getStopTime as Write
+func (w *Writer) CommitReplay(chunks, rows int64, cost time.Duration) {
+	atomic.AddInt64(&w.RowAffects, rows)
+	w.countCommitted(chunks, rows, cost, nil, nil)
+}
+
+// Open creates the archive file, undo log and checkpoint of the job, and saves the checkpoint as running.
+// It's called after the job is confirmed, so that nothing is left if it isn't.
+func (w *Writer) Open(c *conf.Config) error {
+	var err error
+	if c.ArchiveFile != "" {
+		if w.archiver, err = archive.NewFileArchiver(c.ArchiveFile, c.ArchiveFormat, w.Table); err != nil {
+			return fmt.Errorf("open archive file is failed, err: %v", err)
+		}
+	}
+	if c.UndoFile != "" {
+		if w.undo, err = archive.NewUndoLog(c.UndoFile, w.Database, w.Table, w.SqlType, w.unqKeys.UniqueKeyColumns); err != nil {
+			return fmt.Errorf("open undo file is failed, err: %v", err)
+		}
+	}
+
+	if w.checkpointStore == nil {
+		if w.checkpointStore, err = w.newCheckpointStore(c); err != nil {
+			return err
+		}
+	}
+	w.checkpoint = newCheckpoint(w, c)
+	if err = w.saveCheckpoint(vars.JobRunning); err != nil {
+		return fmt.Errorf("save checkpoint is failed, err: %v", err)
+	}
+	return nil
+}
+
+// newCheckpointStore returns nil if checkpoint isn't saved
+func (w *Writer) newCheckpointStore(c *conf.Config) (CheckpointStore, error) {
+	if c.CheckpointFile != "" {
+		return &FileCheckpointStore{Path: c.CheckpointFile}, nil
+	}
+	if !c.CheckpointTable {
+		return nil, nil
+	}
+
+	store, err := NewTableCheckpointStore(w.MysqlClient, w.Database, c.JobId)
+	if err != nil {
+		return nil, fmt.Errorf("create checkpoint table is failed, err: %v", err)
+	}
+	// a new run would overwrite the progress of the unfinished job with the same id
+	if !c.Resume {
+		status, err := store.Status()
+		if err != nil {
+			return nil, fmt.Errorf("check job %s in checkpoint table is failed, err: %v", c.JobId, err)
+		}
+		if status == vars.JobRunning || status == vars.JobInterrupted {
+			return nil, fmt.Errorf("job %s is %s in %s._goc_jobs, continue it by `goc resume --job-id %s` or use another job_id",
+				c.JobId, status, w.Database, c.JobId)
+		}
+	}
+	return store, nil
+}
+
+// WaitTxn waits before a new txn by the tokens sent to bucketNum by getStopTime of task: while slaves lag or it's
+// throttled, for the sleep between txns, and until the next maintenance window
+func (w *Writer) WaitTxn(ctx context.Context, bucket *ratelimit.Bucket, bucketNum chan int64) error {
 	for {
 		// get last bucket number
 		var bucketCount int64
@@ -118,75 +362,147 @@ func (w *Writer) Write(bucket *ratelimit.Bucket, bucketNum chan int64, wg *sync.
 		}
 		if bucketCount == vars.LagThreshold {
 			log.StreamLogger.Debug("Sleep 1s to let slave eliminate lag")
-			bucket.Wait(1000)
+			if err := w.throttleWait(ctx, bucket, 1000); err != nil {
+				return err
+			}
 			continue
 		}
 
 		log.StreamLogger.Debug("bucketCount: %d", bucketCount)
-		bucket.Wait(bucketCount)
+		if err := w.throttleWait(ctx, bucket, bucketCount); err != nil {
+			return err
+		}
+		// the key position is kept in memory until the next window
+		return w.WaitWindow(ctx)
+	}
+}
 
-		var rowAffects int64
+func (w *Writer) Write(ctx context.Context, bucket *ratelimit.Bucket, bucketNum chan int64, wg *sync.WaitGroup) error {
+	maxRetry := 3
+	for {
+		if err := w.WaitTxn(ctx, bucket, bucketNum); err != nil {
+			return w.interrupt(err)
+		}
+
+		var (
+			rowAffects    int64
+			chunkRows     int64
+			chunks        []*Producer
+			limitReached  bool
+			lastKeyValues []*KeyValue
+			firstKey      []*KeyValue
+			latencies     []time.Duration
+			executed      int
+			interrupted   bool
+		)
 		beginTime := time.Now()
 		tx, err := w.MysqlClient.Begin()
 		if err != nil {
 			return err
 		}
 
-		for pr := range w.ProducerQueue {
+	chunkLoop:
+		for {
+			var pr *Producer
+			select {
+			case <-ctx.Done():
+				// stop taking chunks, the chunks executed are finished in this txn
+				interrupted = true
+				break chunkLoop
+			case pr = <-w.ProducerQueue:
+			}
+
 			if pr.IsFinished {
 				log.StreamLogger.Debug("Get whereClause is finished")
 				w.IsFinished = true
 				break
 			}
-
-			// 在这里组装完sql和参数后，传到writer中去
-			execSql := w.ExecuteSQL + pr.WhereClause
-			values := getColumnValue(pr.CurrentKeyValues, w.ChunkSize)
-
-			log.StreamLogger.Debug("execSql: %s", execSql)
-			log.StreamLogger.Debug("parma values: %v", values)
-
-			res, errEx := tx.Exec(execSql, values...)
-			if errEx != nil {
-				// 重试机制 todo 重写一个方法
-				for i := 0; i < maxRetry; i++ {
-					tx, errEx = w.MysqlClient.Begin()
-					if errEx != nil {
-						return errEx
-					}
-
-					res, errEx = tx.Exec(execSql, values...)
-					if errEx != nil {
-						continue
-					} else {
-						break
-					}
+			// LIMIT of user stmt caps the rows affected, the last chunk only affects the rows left
+			if w.RowLimit > 0 {
+				left := w.RowLimit - w.GetRowAffects() - rowAffects
+				if left <= 0 {
+					log.StreamLogger.Debug("row limit %d is reached", w.RowLimit)
+					w.IsFinished = true
+					limitReached = true
+					break
 				}
+				pr = pr.capRows(left)
+			}
 
+			chunkBegin := time.Now()
+			chunks = append(chunks, pr)
+			affects, errEx := w.execChunk(tx, pr)
+			if errEx != nil {
+				// rollback discards the chunks executed before in this txn too, all of them are executed again
+				var total int64
+				tx, total, errEx = w.retryTxn(tx, chunks, maxRetry)
 				if errEx != nil {
 					return errEx
 				}
+				affects = total - rowAffects
 			}
 
 			// 算一下chunk-size和txn-size之间的关系
-			affects, _ := res.RowsAffected()
+			executed++
 			rowAffects += affects
-			if rowAffects >= w.TxnSize {
+			chunkRows += pr.Rows
+			latencies = append(latencies, time.Since(chunkBegin))
+			if n := len(w.unqKeys.UniqueKeyColumns); len(pr.CurrentKeyValues) >= n {
+				if firstKey == nil {
+					firstKey = pr.CurrentKeyValues[:n]
+				}
+				lastKeyValues = pr.CurrentKeyValues[len(pr.CurrentKeyValues)-n:]
+			}
+			if rowAffects >= w.GetTxnSize() {
 				break
 			}
 		}
 
+		if interrupted && executed == 0 {
+			log.StreamLogger.Debug("Interrupted, rollback the empty txn")
+			_ = tx.Rollback()
+			_ = w.rollbackArchive()
+			return w.interrupt(ctx.Err())
+		}
+
+		// circuit breaker, a wrong where clause may change much more rows than expected
+		if err = w.reserveAffects(rowAffects); err != nil {
+			_ = tx.Rollback()
+			_ = w.rollbackArchive()
+			return w.interrupt(err)
+		}
+
 		// 速度的控制应该在txnSize
 		// pt-archiver是在事务结束(commit)之后，才进行sleep
-		err = tx.Commit()
-		if err != nil {
+		if err = w.commitTxn(tx); err != nil {
+			w.releaseAffects(rowAffects)
+			return err
+		}
+		w.countCommitted(int64(executed), chunkRows, time.Since(beginTime), firstKey, latencies)
+		if len(lastKeyValues) != 0 {
+			w.setLastKeyValues(lastKeyValues)
+		}
+
+		if interrupted {
+			log.StreamLogger.Debug("Interrupted, the open txn is committed")
+			return w.interrupt(ctx.Err())
+		}
+
+		status := vars.JobRunning
+		if w.IsFinished {
+			status = vars.JobFinished
+		}
+		if err = w.saveCheckpoint(status); err != nil {
+			log.StreamLogger.Error("save checkpoint got err: %v", err)
 			return err
 		}
-		w.RowAffects += rowAffects
-		w.CostTime = time.Now().Sub(beginTime)
 
 		// finish flag
 		if w.IsFinished {
+			w.finished.Store(true)
+			if limitReached {
+				w.skipChunks(ctx)
+			}
 			log.StreamLogger.Debug("Execute SQL is finished successfully")
 			wg.Done()
 			return nil
@@ -194,14 +510,403 @@ func (w *Writer) Write(bucket *ratelimit.Bucket, bucketNum chan int64, wg *sync.
 	}
 }
 
-func (w *Writer) tableExists() bool {
+// retryTxn rolls back tx and executes all chunks of it again in a new txn, up to maxRetry times.
+// It returns the new txn and rows affected by the chunks.
+func (w *Writer) retryTxn(tx *sql.Tx, chunks []*Producer, maxRetry int) (*sql.Tx, int64, error) {
+	var err error
+	for i := 0; i < maxRetry; i++ {
+		w.stats.addRetry()
+		_ = tx.Rollback()
+		if err = w.rollbackArchive(); err != nil {
+			return nil, 0, err
+		}
+
+		tx, err = w.MysqlClient.Begin()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var total int64
+		for _, pr := range chunks {
+			var affects int64
+			if affects, err = w.execChunk(tx, pr); err != nil {
+				break
+			}
+			total += affects
+		}
+		if err == nil {
+			return tx, total, nil
+		}
+	}
+
+	_ = tx.Rollback()
+	_ = w.rollbackArchive()
+	return nil, 0, err
+}
+
+// commitTxn commits the archived rows and undo log before tx, nothing is written to source unless they are committed.
+// They are at least once: if tx fails to commit after them, they are kept, because the commit may have succeeded
+// on the server, and the chunks are archived again when job continues.
+func (w *Writer) commitTxn(tx *sql.Tx) error {
+	// nothing is deleted unless the archived rows are fsynced or committed in dest
+	if w.archiver != nil {
+		if err := w.archiver.Commit(); err != nil {
+			_ = tx.Rollback()
+			_ = w.rollbackArchive()
+			return fmt.Errorf("commit archived rows is failed, txn is rollback, err: %v", err)
+		}
+	}
+	// nothing is changed unless the before-image is fsynced
+	if w.undo != nil {
+		if err := w.undo.Commit(); err != nil {
+			_ = tx.Rollback()
+			_ = w.rollbackArchive()
+			return fmt.Errorf("commit undo log is failed, txn is rollback, err: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// countCommitted counts the chunks of a txn after it's committed, chunks of a txn rolled back aren't counted
+func (w *Writer) countCommitted(chunks, chunkRows int64, cost time.Duration, firstKey []*KeyValue, latencies []time.Duration) {
+	w.addCommitted(chunks, chunkRows)
+	w.setCostTime(cost)
+	if w.parent != nil {
+		w.parent.setCostTime(cost)
+	}
+	w.observeRate(chunkRows, cost)
+	w.stats.commit(firstKey, latencies)
+}
+
+// RerunChunk executes a chunk found by verify in its own txn, rows are archived and logged in undo log,
+// and counted into the circuit breaker and stats as Write does
+func (w *Writer) RerunChunk(pr *Producer) (int64, error) {
+	beginTime := time.Now()
+	tx, err := w.MysqlClient.Begin()
+	if err != nil {
+		return 0, err
+	}
+	affects, err := w.execChunk(tx, pr)
+	if err != nil {
+		_ = tx.Rollback()
+		_ = w.rollbackArchive()
+		return 0, err
+	}
+	latency := time.Since(beginTime)
+
+	if err = w.reserveAffects(affects); err != nil {
+		_ = tx.Rollback()
+		_ = w.rollbackArchive()
+		return 0, err
+	}
+	if err = w.commitTxn(tx); err != nil {
+		w.releaseAffects(affects)
+		return 0, err
+	}
+
+	var firstKey []*KeyValue
+	if n := len(w.unqKeys.UniqueKeyColumns); len(pr.CurrentKeyValues) >= n {
+		firstKey = pr.CurrentKeyValues[:n]
+	}
+	w.countCommitted(1, pr.Rows, time.Since(beginTime), firstKey, []time.Duration{latency})
+	return affects, nil
+}
+
+// FinishRerun saves the rows affected by RerunChunk into the checkpoint, once after the rerun pass
+func (w *Writer) FinishRerun() error {
+	return w.saveCheckpoint(vars.JobFinished)
+}
+
+// VerifyWhereClause matches the rows left after the job: rows matching the where clause of delete,
+// or rows matching the where clause of update but still different from SET
+func (w *Writer) VerifyWhereClause() string {
+	if w.verifyCondition == "" {
+		return w.OriginWhereClause
+	}
+	return fmt.Sprintf("%s AND %s", w.OriginWhereClause, w.verifyCondition)
+}
+
+// execChunk executes the chunk in tx, rows of the chunk are archived before being deleted
+func (w *Writer) execChunk(tx *sql.Tx, pr *Producer) (int64, error) {
+	// 在这里组装完sql和参数后，传到writer中去
+	execSql, values := w.ExecStmt(pr)
+
+	var archived int64 = -1
+	if w.archiver != nil {
+		var err error
+		archived, err = w.archiveChunk(tx, w.archiver, w.archiveSQL, pr.WhereClause, values)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if w.undo != nil {
+		if _, err := w.archiveChunk(tx, w.undo, w.undoSQL, pr.WhereClause, values); err != nil {
+			return 0, err
+		}
+	}
+
+	log.StreamLogger.Debug("execSql: %s", execSql)
+	log.StreamLogger.Debug("parma values: %v", values)
+
+	res, err := tx.Exec(execSql, values...)
+	if err != nil {
+		return 0, err
+	}
+	affects, _ := res.RowsAffected()
+	if archived >= 0 && affects > archived {
+		return 0, fmt.Errorf("chunk deleted %d rows, but only %d rows are archived", affects, archived)
+	}
+	return affects, nil
+}
+
+// archiveChunk locks the rows of chunk and passes them to archiver, returns the number of rows archived
+func (w *Writer) archiveChunk(tx *sql.Tx, archiver archive.Archiver, selectBase string, whereClause string, values []any) (int64, error) {
+	selectSql := selectBase + whereClause + " FOR UPDATE"
+	log.StreamLogger.Debug("archiveSql: %s", selectSql)
+
+	rows, err := tx.Query(selectSql, values...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, data, err := archive.ScanRows(rows)
+	if err != nil {
+		return 0, err
+	}
+	if err = archiver.Archive(columns, data); err != nil {
+		return 0, fmt.Errorf("archive rows is failed, err: %v", err)
+	}
+	return int64(len(data)), nil
+}
+
+func (w *Writer) newDestArchiver(c *conf.Config) (archive.Archiver, error) {
+	dest, err := c.DestInfo()
+	if err != nil {
+		return nil, err
+	}
+	if dest.Host == c.Host && dest.Port == c.Port && dest.Database == w.Database && dest.Table == w.Table {
+		return nil, fmt.Errorf("dest %s is the source table", dest)
+	}
+
+	client, err := NewMysqlClientForDest(dest)
+	if err != nil {
+		return nil, err
+	}
+	var count int
+	if err = client.QueryRow(vars.TableExistsSQL, dest.Database, dest.Table).Scan(&count); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	if count != 1 {
+		_ = client.Close()
+		return nil, fmt.Errorf("dest table %s.%s does not exist", dest.Database, dest.Table)
+	}
+	return archive.NewDestArchiver(client, dest.Table), nil
+}
+
+// prepareUndo selects the columns of deleted rows which aren't generated, or the key and SET columns of updated rows as before-image
+func (w *Writer) prepareUndo() error {
+	if (w.SqlType != "Delete" && w.SqlType != "Update") || w.multiTable {
+		return errors.New("undo_file only works with single-table `update` and `delete`")
+	}
+
+	keys := w.unqKeys.UniqueKeyColumns
+	columns := quoteColumns(w.columns)
+	if w.SqlType == "Update" {
+		selected := make([]string, 0, len(keys)+len(w.setColumns))
+		for _, key := range keys {
+			selected = append(selected, w.unqKeys.quoteColumn(key))
+		}
+		for _, col := range w.setColumns {
+			for _, key := range keys {
+				if strings.EqualFold(col, key) {
+					return fmt.Errorf("updated rows can't be located by the undo log, key column %s is updated", col)
+				}
+			}
+			selected = append(selected, fmt.Sprintf("`%s`", col))
+		}
+		columns = strings.Join(selected, ", ")
+	}
+	w.undoSQL = fmt.Sprintf(vars.UndoSelectSQL, columns, w.Table) + w.OriginWhereClause
+	return nil
+}
+
+func (w *Writer) rollbackArchive() error {
+	if w.undo != nil {
+		if err := w.undo.Rollback(); err != nil {
+			return err
+		}
+	}
+	if w.archiver == nil {
+		return nil
+	}
+	return w.archiver.Rollback()
+}
+
+// CloseArchiver closes the archive file or connection, and the undo log
+func (w *Writer) CloseArchiver() {
+	if w.archiver != nil {
+		_ = w.archiver.Close()
+	}
+	if w.undo != nil {
+		_ = w.undo.Close()
+	}
+}
+
+// interrupt saves the checkpoint of the last commit and returns the reason of interruption
+func (w *Writer) interrupt(reason error) error {
+	if err := w.saveCheckpoint(vars.JobInterrupted); err != nil {
+		log.StreamLogger.Error("save checkpoint got err: %v", err)
+	}
+	return reason
+}
+
+// throttleSlice is the longest part of a wait which is counted by one throttle state
+const throttleSlice = 100 * time.Millisecond
+
+// throttleWait waits for the tokens. Every slice of the wait is counted by the throttle state at its start,
+// so that a wait across a change of state is split into both of them.
+func (w *Writer) throttleWait(ctx context.Context, bucket *ratelimit.Bucket, count int64) error {
+	deadline := time.Now().Add(bucket.Take(count))
+	for {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return ctx.Err()
+		}
+
+		state := w.Throttle()
+		begin := time.Now()
+		err := sleepContext(ctx, min(left, throttleSlice))
+		if state != vars.ThrottleNone {
+			w.stats.addThrottle(state, time.Since(begin))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// InWindow returns true if new txns are allowed to start at t by the maintenance windows
+func (w *Writer) InWindow(t time.Time) bool {
+	return w.windows.Contains(t)
+}
+
+// WaitWindow waits until the next maintenance window if it's out of windows now, without an open txn
+func (w *Writer) WaitWindow(ctx context.Context) error {
+	begin := time.Now()
+	if w.windows.Contains(begin) {
+		return nil
+	}
+
+	w.SetThrottle(vars.ThrottleWindow)
+	log.StreamLogger.Warn("out of maintenance windows, continue at %s", w.windows.Next(begin).Format("2006-01-02 15:04:05 MST"))
+	// check every minute, so that the wait is right after the change of clock or daylight saving time
+	for !w.windows.Contains(time.Now()) {
+		wait := min(time.Until(w.windows.Next(time.Now())), time.Minute)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			w.stats.addThrottle(vars.ThrottleWindow, time.Since(begin))
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	w.stats.addThrottle(vars.ThrottleWindow, time.Since(begin))
+	return nil
+}
+
+// sleepContext sleeps d, it returns ctx.Err() if ctx is done before
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// GetTxnSize returns TxnSize, which can be changed by control socket while job is running
+func (w *Writer) GetTxnSize() int64 {
+	return atomic.LoadInt64(&w.job().TxnSize)
+}
+
+func (w *Writer) SetTxnSize(txnSize int64) {
+	atomic.StoreInt64(&w.job().TxnSize, txnSize)
+}
+
+// Pause makes writer and the other workers of its job stop taking new txn until Resume is called
+func (w *Writer) Pause() {
+	atomic.StoreInt32(&w.job().paused, 1)
+}
+
+func (w *Writer) Resume() {
+	atomic.StoreInt32(&w.job().paused, 0)
+}
+
+func (w *Writer) IsPaused() bool {
+	return atomic.LoadInt32(&w.job().paused) == 1
+}
+
+// SetThrottle records why writer is throttled now: paused, max-lag, lag, sleep or none
+func (w *Writer) SetThrottle(state string) {
+	job := w.job()
+	job.mu.Lock()
+	job.throttle = state
+	job.mu.Unlock()
+}
+
+func (w *Writer) Throttle() string {
+	job := w.job()
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.throttle
+}
+
+// ExecStmt assembles the sql and args which will be executed for the chunk
+func (w *Writer) ExecStmt(pr *Producer) (string, []any) {
+	return w.ExecuteSQL + pr.WhereClause + w.execSuffix, getColumnValue(pr.CurrentKeyValues, w.ChunkSize)
+}
+
+// BindArgs inlines the args of stmt, values are quoted for sql_mode of the sessions
+func (w *Writer) BindArgs(query string, args []any) string {
+	return utils.BindArgs(query, args, w.noBackslashEscapes)
+}
+
+// UniqueKeyColumns returns the columns of the key which is used to chunk
+func (w *Writer) UniqueKeyColumns() []string {
+	if w.unqKeys == nil {
+		return nil
+	}
+	return w.unqKeys.UniqueKeyColumns
+}
+
+// KeyRange returns MIN and MAX of the leading key column, ok is false if the column isn't an integer
+func (w *Writer) KeyRange() (min, max float64, ok bool, err error) {
+	if !isIntegerType(w.unqKeys.UniqueKeyTypes[0]) {
+		return 0, 0, false, nil
+	}
+
+	var minValue, maxValue sql.NullFloat64
+	col := w.unqKeys.UniqueKeyColumns[0]
+	err = w.MysqlClient.QueryRow(fmt.Sprintf(vars.KeyRangeSQL, col, col, w.Database, w.Table)).Scan(&minValue, &maxValue)
+	if err != nil || !minValue.Valid || !maxValue.Valid {
+		return 0, 0, false, err
+	}
+	return minValue.Float64, maxValue.Float64, true, nil
+}
+
+func (w *Writer) tableExists() (bool, error) {
 	var count int
 	err := w.MysqlClient.QueryRow(vars.TableExistsSQL, w.Database, w.Table).Scan(&count)
 	if err != nil {
-		log.StreamLogger.Error("tableExists scan failed, err:%v", err)
-		os.Exit(1)
+		return false, fmt.Errorf("tableExists scan failed, err:%v", err)
 	}
-	return count == 1
+	return count == 1, nil
 }
 
 // getInfoFromTable use tidb parser to build necessary info
@@ -215,28 +920,76 @@ func (w *Writer) getInfoFromTable(c *conf.Config) error {
 	}
 
 	if len(sqlStmt) == 0 || len(sqlStmt) > 1 {
-		log.StreamLogger.Error("SQL is empty? or SQL number is over 1? pls confirm SQL number is only 1")
-		os.Exit(1)
+		return errors.New("SQL is empty? or SQL number is over 1? pls confirm SQL number is only 1")
 	}
 
 	node := sqlStmt[0]
 	v := &visitor{}
+	switch node.(type) {
+	case *ast.DeleteStmt, *ast.UpdateStmt:
+		if !isMultiTable(node) {
+			break
+		}
+		// multi-table stmt is chunked on the key of driving table, the join is kept in both boundary select and exec stmt
+		if err = w.parseMultiTable(node, c, v); err != nil {
+			return err
+		}
+	}
+
 	switch node.(type) {
 	case *ast.DeleteStmt:
+		if w.multiTable {
+			break
+		}
 		w.SqlType = "Delete"
 		node.Accept(v)
 
 		w.ExecuteSQL = fmt.Sprintf("DELETE FROM `%s` WHERE ", w.Table)
 	case *ast.UpdateStmt:
+		if w.multiTable {
+			break
+		}
 		w.SqlType = "Update"
 		node.Accept(v)
+		w.setColumns = updateColumns(node.(*ast.UpdateStmt))
 
 		re := regexp.MustCompile(`set.*where|SET.*WHERE|set.*WHERE|SET.*where`)
 		sub := re.FindString(c.ExecuteQuery)
 		w.ExecuteSQL = fmt.Sprintf("UPDATE `%s` %s ", w.Table, sub)
+	case *ast.InsertStmt:
+		// insert/replace ... select is chunked on the source table
+		stmt := node.(*ast.InsertStmt)
+		w.SqlType = "Insert"
+		if stmt.IsReplace {
+			w.SqlType = "Replace"
+		}
+
+		is, err := parseInsertSelect(stmt)
+		if err != nil {
+			return err
+		}
+		if is.database != "" && is.database != w.Database {
+			return fmt.Errorf("source table of insert must be in database %s, got: %s.%s", w.Database, is.database, is.table)
+		}
+		v.whereClause = is.whereClause
+		v.orderLimit = is.orderLimit
+		w.fromClause = is.fromClause
+		w.tableAlias = is.alias
+		w.execSuffix = is.suffix
+		w.ExecuteSQL = is.prefix + " WHERE "
 	default:
-		log.StreamLogger.Error("please confirm sql type is `update` or `delete`")
-		os.Exit(1)
+		return errors.New("please confirm sql type is `update`, `delete` or `insert/replace ... select`")
+	}
+
+	if v.err != nil {
+		return v.err
+	}
+	if stmt, ok := node.(*ast.UpdateStmt); ok {
+		w.verifyCondition = setDiffCondition(stmt.List)
+		w.verifyErr = setVerifiable(stmt.List)
+	}
+	if v.orderLimit != nil {
+		w.RowLimit = v.orderLimit.limit
 	}
 
 	if v.whereClause != "" {
@@ -252,16 +1005,14 @@ func (w *Writer) getInfoFromTable(c *conf.Config) error {
 	var tableMeta string
 	rows, err := w.MysqlClient.Query(fmt.Sprintf(vars.TableInfoSQL, w.Database+"."+w.Table))
 	if err != nil {
-		log.StreamLogger.Error("`show create Table %s` got err: %v", w.Database+"."+w.Table, err)
-		os.Exit(1)
+		return fmt.Errorf("`show create Table %s` got err: %v", w.Database+"."+w.Table, err)
 	}
 
 	defer rows.Close()
 
 	cols, err := rows.Columns()
 	if err != nil {
-		log.StreamLogger.Error("`show create Table %s` got err: %v", w.Database+"."+w.Table, err)
-		os.Exit(1)
+		return fmt.Errorf("`show create Table %s` got err: %v", w.Database+"."+w.Table, err)
 	}
 
 	for rows.Next() {
@@ -271,8 +1022,7 @@ func (w *Writer) getInfoFromTable(c *conf.Config) error {
 		}
 
 		if err = rows.Scan(scanArgs...); err != nil {
-			log.StreamLogger.Error("`show create Table %s` got err: %v", w.Database+"."+w.Table, err)
-			os.Exit(1)
+			return fmt.Errorf("`show create Table %s` got err: %v", w.Database+"."+w.Table, err)
 		}
 		tableMeta = ColumnValue(scanArgs, cols, "Create Table")
 	}
@@ -286,14 +1036,27 @@ func (w *Writer) getInfoFromTable(c *conf.Config) error {
 	tableNode := tableStmt[0]
 	switch tableNode.(type) {
 	case *ast.CreateTableStmt:
+		w.columns = storedColumns(tableNode.(*ast.CreateTableStmt))
 		uks = GetPossibleUniqueKeys(tableNode.(*ast.CreateTableStmt))
 		if len(uks) == 0 {
-			log.StreamLogger.Error("Can't find any index which is primary or unique key")
-			os.Exit(1)
+			return errors.New("Can't find any index which is primary or unique key")
 		}
 	default:
-		log.StreamLogger.Error("tableMeta is not CreateTableStmt, something goes wrong, tableMeta: %s", tableMeta)
-		os.Exit(1)
+		return fmt.Errorf("tableMeta is not CreateTableStmt, something goes wrong, tableMeta: %s", tableMeta)
+	}
+
+	// ORDER BY of user stmt must be the same order as chunks
+	if v.orderLimit != nil && len(v.orderLimit.orderBy) != 0 {
+		matched := make([]*UnqKeys, 0, len(uks))
+		for _, uk := range uks {
+			if v.orderLimit.matchKey(uk.UniqueKeyColumns) {
+				matched = append(matched, uk)
+			}
+		}
+		if len(matched) == 0 {
+			return fmt.Errorf("order by %s doesn't match any primary/unique key, rows are changed in the order of key", strings.Join(v.orderLimit.orderBy, ","))
+		}
+		uks = matched
 	}
 
 	if c.ForceChunkingColumn != "" {
@@ -310,8 +1073,7 @@ func (w *Writer) getInfoFromTable(c *conf.Config) error {
 		}
 
 		// 如果for结束没有数据，说明使用者瞎写的ForceChunkingColumn
-		log.StreamLogger.Error("forced_chunking_column doesn't conform to primary or unique key, ForceChunkingColumn: %s", c.ForceChunkingColumn)
-		os.Exit(1)
+		return fmt.Errorf("forced_chunking_column doesn't conform to primary or unique key, ForceChunkingColumn: %s", c.ForceChunkingColumn)
 	}
 
 	for _, uk := range uks {
@@ -325,18 +1087,39 @@ func (w *Writer) getInfoFromTable(c *conf.Config) error {
 	return nil
 }
 
-func (w *Writer) lockTableRead() {
+func (w *Writer) parseMultiTable(node ast.StmtNode, c *conf.Config, v *visitor) error {
+	mt, err := parseMultiTable(node, c.DrivingTable)
+	if err != nil {
+		return err
+	}
+	if mt.driving.database != "" && mt.driving.database != w.Database {
+		return fmt.Errorf("driving table must be in database %s, got: %s.%s", w.Database, mt.driving.database, mt.driving.table)
+	}
+
+	w.SqlType = "Delete"
+	if _, ok := node.(*ast.UpdateStmt); ok {
+		w.SqlType = "Update"
+	}
+	v.whereClause = mt.whereClause
+	w.multiTable = true
+	w.fromClause = mt.fromClause
+	w.tableAlias = mt.driving.name()
+	w.ExecuteSQL = mt.prefix + " WHERE "
+	return nil
+}
+
+func (w *Writer) lockTableRead() error {
 	_, err := w.MysqlClient.Exec(fmt.Sprintf(vars.LockTableSQL, w.Database, w.Table))
 	if err != nil {
-		log.StreamLogger.Error("lockTableRead failed, err:%v", err)
-		os.Exit(1)
+		return fmt.Errorf("lockTableRead failed, err:%v", err)
 	}
+	return nil
 }
 
-func (w *Writer) unlockTable() {
+func (w *Writer) unlockTable() error {
 	_, err := w.MysqlClient.Exec(vars.UnlockTableSQL)
 	if err != nil {
-		log.StreamLogger.Error("lockTableRead failed, err:%v", err)
-		os.Exit(1)
+		return fmt.Errorf("lockTableRead failed, err:%v", err)
 	}
+	return nil
 }
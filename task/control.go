@@ -0,0 +1,190 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/log"
+	"go-oak-chunk/v2/mysql"
+	"go-oak-chunk/v2/task/lag_checker"
+)
+
+const controlHelp = `commands:
+  pause                 stop taking new txn
+  resume                continue after pause
+  set sleep=<seconds>   change sleep between txn
+  set max-lag=<seconds> change max slave lag, 0 means no limit
+  set txn-size=<rows>   change number of rows per transaction
+  status                show progress and current settings
+  abort                 finish the open txn and exit
+  help                  show this message`
+
+// controlServer accepts commands from a unix socket to tune the job while it is running, like gh-ost
+type controlServer struct {
+	config   *conf.Config
+	writer   *mysql.Writer
+	slave    *lag_checker.SlaveChecker
+	est      *estimator
+	abort    context.CancelFunc
+	listener net.Listener
+}
+
+func startControlServer(path string, c *conf.Config, w *mysql.Writer, sl *lag_checker.SlaveChecker, est *estimator, abort context.CancelFunc) (*controlServer, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// the socket accepts abort and set, only the owner can connect
+	if err = os.Chmod(path, 0600); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	s := &controlServer{
+		config:   c,
+		writer:   w,
+		slave:    sl,
+		est:      est,
+		abort:    abort,
+		listener: listener,
+	}
+	go s.serve()
+	log.StreamLogger.Debug("control socket is listening on %s", path)
+	return s, nil
+}
+
+// removeStaleSocket removes the socket left by a killed job. It refuses to remove a file which isn't a socket,
+// or the socket of a running job.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and isn't a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is used by another running job", path)
+	}
+	return os.Remove(path)
+}
+
+func (s *controlServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.StreamLogger.Error("control socket accept got err: %v", err)
+			}
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *controlServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if _, err := fmt.Fprintln(conn, s.handle(line)); err != nil {
+			return
+		}
+	}
+}
+
+// handle executes one command and returns the reply
+func (s *controlServer) handle(line string) string {
+	fields := strings.Fields(line)
+	switch strings.ToLower(fields[0]) {
+	case "pause":
+		s.writer.Pause()
+		log.StreamLogger.Error("[CONTROL] job is paused")
+		return "OK paused"
+	case "resume":
+		s.writer.Resume()
+		log.StreamLogger.Error("[CONTROL] job is resumed")
+		return "OK resumed"
+	case "set":
+		if len(fields) != 2 {
+			return "ERR usage: set <sleep|max-lag|txn-size>=<value>"
+		}
+		return s.set(fields[1])
+	case "status":
+		return s.status()
+	case "abort":
+		log.StreamLogger.Error("[CONTROL] job is aborted")
+		s.abort()
+		return "OK aborting, the open txn will be finished"
+	case "help":
+		return controlHelp
+	default:
+		return fmt.Sprintf("ERR unknown command %q\n%s", fields[0], controlHelp)
+	}
+}
+
+func (s *controlServer) set(assignment string) string {
+	name, value, found := strings.Cut(assignment, "=")
+	if !found {
+		return "ERR usage: set <sleep|max-lag|txn-size>=<value>"
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Sprintf("ERR %s must be a nonnegative number", name)
+	}
+
+	switch name {
+	case "sleep":
+		s.config.SetSleep(n)
+	case "max-lag", "max_lag":
+		s.config.SetMaxLag(n)
+	case "txn-size", "txn_size":
+		if n == 0 {
+			return "ERR txn-size must be positive"
+		}
+		s.writer.SetTxnSize(n)
+	default:
+		return fmt.Sprintf("ERR unknown setting %q", name)
+	}
+	log.StreamLogger.Error("[CONTROL] set %s=%d", name, n)
+	return fmt.Sprintf("OK %s=%d", name, n)
+}
+
+func (s *controlServer) status() string {
+	st := buildStatus(s.config, s.writer, s.slave, s.est)
+	return strings.Join([]string{
+		fmt.Sprintf("sql: [%s] %s", st.SqlType, st.ExecuteSQL),
+		fmt.Sprintf("row_affects: %d", st.RowAffects),
+		fmt.Sprintf("chunks: %d", st.Chunks),
+		fmt.Sprintf("percent: %.2f", st.Percent),
+		fmt.Sprintf("eta_seconds: %.0f", st.ETA),
+		fmt.Sprintf("last_key: %s", mysql.KeyValuesString(st.LastKey)),
+		fmt.Sprintf("paused: %v", st.Paused),
+		fmt.Sprintf("throttle: %s", st.Throttle),
+		fmt.Sprintf("sleep: %d", st.Sleep),
+		fmt.Sprintf("max_lag: %d", st.MaxLag),
+		fmt.Sprintf("txn_size: %d", st.TxnSize),
+		fmt.Sprintf("slave_lag: %d", st.SlaveMaxLag),
+	}, "\n")
+}
+
+func (s *controlServer) Close() {
+	_ = s.listener.Close()
+}
@@ -0,0 +1,76 @@
+package task
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/mysql"
+)
+
+func TestControlHandle(t *testing.T) {
+	aborted := false
+	s := &controlServer{
+		config: &conf.Config{Sleep: 1, MaxLag: 10},
+		writer: &mysql.Writer{TxnSize: 1000},
+		abort:  func() { aborted = true },
+	}
+
+	for _, cmd := range []string{"pause", "set sleep=2", "set max-lag=5", "set txn-size=500"} {
+		if reply := s.handle(cmd); !strings.HasPrefix(reply, "OK") {
+			t.Fatalf("%s got reply: %s", cmd, reply)
+		}
+	}
+	if !s.writer.IsPaused() || s.config.GetSleep() != 2 || s.config.GetMaxLag() != 5 || s.writer.GetTxnSize() != 500 {
+		t.Fatalf("settings are not changed: %s", s.status())
+	}
+
+	for _, cmd := range []string{"set txn-size=0", "set sleep=-1", "set chunk-size=1", "drop"} {
+		if reply := s.handle(cmd); !strings.HasPrefix(reply, "ERR") {
+			t.Fatalf("%s should be rejected, got reply: %s", cmd, reply)
+		}
+	}
+
+	s.handle("resume")
+	s.handle("abort")
+	if s.writer.IsPaused() || !aborted {
+		t.Fatal("resume or abort doesn't work")
+	}
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+	if err := removeStaleSocket(filepath.Join(dir, "none.sock")); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "file.sock")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(file); err == nil {
+		t.Fatal("regular file should not be removed")
+	}
+
+	path := filepath.Join(dir, "goc.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = removeStaleSocket(path); err == nil {
+		t.Fatal("socket of a running job should not be removed")
+	}
+
+	// socket left by a killed job
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if err = removeStaleSocket(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Lstat(path); !os.IsNotExist(err) {
+		t.Fatalf("stale socket is not removed, err: %v", err)
+	}
+}
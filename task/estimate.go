@@ -0,0 +1,167 @@
+package task
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"go-oak-chunk/v2/log"
+	"go-oak-chunk/v2/mysql"
+)
+
+// estimateWindow is how long the samples of moving average are kept
+const estimateWindow = time.Minute
+
+// estimator estimates percent complete and ETA of a job. If rows are pre-counted, it's based on the rows of chunks,
+// otherwise on where the last committed key is between MIN and MAX of the leading key column.
+type estimator struct {
+	mu sync.Mutex
+	// total is the rows to walk in this run, 0 if rows are not pre-counted
+	total    int64
+	lower    float64
+	upper    float64
+	hasRange bool
+	samples  []progressSample
+}
+
+type progressSample struct {
+	at       time.Time
+	rows     int64
+	fraction float64
+}
+
+type Estimate struct {
+	// Percent is -1 if it's unknown
+	Percent float64
+	// RowRate is the moving average of rows affected per second
+	RowRate float64
+	// ETA is -1 if it's unknown
+	ETA time.Duration
+}
+
+func newEstimator(w *mysql.Writer) *estimator {
+	e := &estimator{}
+	if w.PreCount > 0 {
+		e.total = w.PreCount - w.GetRowAffects()
+		return e
+	}
+
+	lower, upper, ok, err := w.KeyRange()
+	if err != nil {
+		log.StreamLogger.Debug("get key range got err: %v, percent complete is unknown", err)
+		return e
+	}
+	if !ok {
+		log.StreamLogger.Debug("leading key column isn't an integer, percent complete is unknown without --precount")
+		return e
+	}
+
+	// job continued from checkpoint starts from the key of checkpoint
+	if len(w.StartKeyValues) != 0 {
+		if v, ok := keyFloat(w.StartKeyValues[0].ColumnValue); ok {
+			lower = v
+		}
+	}
+	e.lower, e.upper = lower, upper
+	e.hasRange = upper > lower
+	return e
+}
+
+// estimate samples the progress of writer and returns the estimate
+func (e *estimator) estimate(w *mysql.Writer, now time.Time) Estimate {
+	fraction, ok := e.fraction(w)
+	return e.observe(now, w.GetRowAffects(), fraction, ok)
+}
+
+func (e *estimator) fraction(w *mysql.Writer) (float64, bool) {
+	switch {
+	case e.total > 0:
+		return clamp(float64(w.GetChunkRows()) / float64(e.total)), true
+	case e.hasRange:
+		keyValues := w.LastKeyValues()
+		if len(keyValues) == 0 {
+			return 0, true
+		}
+		v, ok := keyFloat(keyValues[0].ColumnValue)
+		if !ok {
+			return 0, false
+		}
+		return clamp((v - e.lower) / (e.upper - e.lower)), true
+	}
+	return 0, false
+}
+
+func (e *estimator) observe(now time.Time, rows int64, fraction float64, ok bool) Estimate {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// one sample per second is enough, samples out of window are dropped
+	if n := len(e.samples); n == 0 || now.Sub(e.samples[n-1].at) >= time.Second {
+		e.samples = append(e.samples, progressSample{at: now, rows: rows, fraction: fraction})
+	}
+	for len(e.samples) > 2 && now.Sub(e.samples[0].at) > estimateWindow {
+		e.samples = e.samples[1:]
+	}
+
+	est := Estimate{Percent: -1, ETA: -1}
+	if ok {
+		est.Percent = fraction * 100
+	}
+	first := e.samples[0]
+	elapsed := now.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		return est
+	}
+
+	est.RowRate = float64(rows-first.rows) / elapsed
+	if ok {
+		if fraction >= 1 {
+			est.ETA = 0
+		} else if speed := (fraction - first.fraction) / elapsed; speed > 0 {
+			est.ETA = time.Duration((1 - fraction) / speed * float64(time.Second))
+		}
+	}
+	return est
+}
+
+func clamp(f float64) float64 {
+	if f < 0 {
+		return 0
+	}
+	if f > 1 {
+		return 1
+	}
+	return f
+}
+
+func keyFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// percentString and etaString return `-` when it's unknown
+func (e Estimate) percentString() string {
+	if e.Percent < 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(e.Percent, 'f', 2, 64) + "%"
+}
+
+func (e Estimate) etaString() string {
+	if e.ETA < 0 {
+		return "-"
+	}
+	return e.ETA.Round(time.Second).String()
+}
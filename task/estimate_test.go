@@ -0,0 +1,47 @@
+package task
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimatorObserve(t *testing.T) {
+	e := &estimator{}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	est := e.observe(start, 0, 0, true)
+	if est.Percent != 0 || est.RowRate != 0 || est.ETA != -1 {
+		t.Fatalf("unexpected first estimate: %+v", est)
+	}
+
+	// 25% in 10s, 75% left needs 30s
+	est = e.observe(start.Add(10*time.Second), 1000, 0.25, true)
+	if est.Percent != 25 || est.RowRate != 100 || est.ETA != 30*time.Second {
+		t.Fatalf("unexpected estimate: %+v", est)
+	}
+
+	est = e.observe(start.Add(20*time.Second), 2000, 1, true)
+	if est.ETA != 0 {
+		t.Fatalf("eta should be 0 when finished: %+v", est)
+	}
+
+	// samples out of window are dropped, rate is of the last minute
+	e = &estimator{}
+	e.observe(start, 0, 0, false)
+	e.observe(start.Add(30*time.Second), 0, 0, false)
+	est = e.observe(start.Add(90*time.Second), 6000, 0, false)
+	if est.Percent != -1 || est.ETA != -1 || est.RowRate != 100 {
+		t.Fatalf("unexpected estimate without fraction: %+v", est)
+	}
+}
+
+func TestEstimateString(t *testing.T) {
+	est := Estimate{Percent: -1, ETA: -1}
+	if est.percentString() != "-" || est.etaString() != "-" {
+		t.Fatalf("unknown should be -")
+	}
+	est = Estimate{Percent: 12.345, ETA: 90*time.Second + 400*time.Millisecond}
+	if est.percentString() != "12.35%" || est.etaString() != "1m30s" {
+		t.Fatalf("got %s %s", est.percentString(), est.etaString())
+	}
+}
@@ -0,0 +1,132 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go-oak-chunk/v2/log"
+	"go-oak-chunk/v2/vars"
+)
+
+// httpServer serves json status on /status and prometheus metrics on /metrics
+type httpServer struct {
+	server *http.Server
+	status func() *Status
+}
+
+func startHTTPServer(addr string, status func() *Status) (*httpServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &httpServer{status: status}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.StreamLogger.Error("http server got err: %v", err)
+		}
+	}()
+	log.StreamLogger.Debug("http server is listening on %s", listener.Addr())
+	return s, nil
+}
+
+func (s *httpServer) handleStatus(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s.status()); err != nil {
+		log.StreamLogger.Error("encode status got err: %v", err)
+	}
+}
+
+func (s *httpServer) handleMetrics(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = rw.Write([]byte(formatMetrics(s.status())))
+}
+
+// formatMetrics formats status in prometheus text format
+func formatMetrics(st *Status) string {
+	var (
+		buf    strings.Builder
+		labels = fmt.Sprintf(`database=%q,table=%q`, st.Database, st.Table)
+	)
+	metric := func(name, tp, help string, value float64, extraLabels ...string) {
+		l := labels
+		if len(extraLabels) != 0 {
+			l += "," + strings.Join(extraLabels, ",")
+		}
+		if tp != "" {
+			fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, tp)
+		}
+		fmt.Fprintf(&buf, "%s{%s} %g\n", name, l, value)
+	}
+
+	metric("goc_rows_affected_total", "counter", "Rows affected by chunk dml.", float64(st.RowAffects))
+	metric("goc_chunks_total", "counter", "Chunks executed.", float64(st.Chunks))
+	metric("goc_elapsed_seconds", "gauge", "Seconds since job started.", st.Elapsed)
+	metric("goc_rows_per_second", "gauge", "Average rows affected per second.", st.RowRate)
+	metric("goc_chunks_per_second", "gauge", "Average chunks executed per second.", st.ChunkRate)
+	metric("goc_recent_rows_per_second", "gauge", "Moving average of rows affected per second.", st.RecentRate)
+	metric("goc_percent_complete", "gauge", "Percent complete, -1 means unknown.", st.Percent)
+	metric("goc_eta_seconds", "gauge", "Estimated seconds left, -1 means unknown.", st.ETA)
+	metric("goc_last_txn_seconds", "gauge", "Seconds of the last txn.", st.CostTime)
+	metric("goc_paused", "gauge", "Whether job is paused by control socket.", boolValue(st.Paused))
+	metric("goc_finished", "gauge", "Whether job is finished.", boolValue(st.Finished))
+
+	states := []string{vars.ThrottleNone, vars.ThrottleSleep, vars.ThrottleLag, vars.ThrottleMaxLag, vars.ThrottlePaused, vars.ThrottleWindow, vars.ThrottleMaxLoad,
+		vars.ThrottleQuery, vars.ThrottleFlagFile, vars.ThrottleHTTP}
+	for i, state := range states {
+		tp := ""
+		if i == 0 {
+			tp = "gauge"
+		}
+		metric("goc_throttle", tp, "Current throttle state of job.", boolValue(st.Throttle == state), fmt.Sprintf(`state=%q`, state))
+	}
+
+	metric("goc_sleep_seconds", "gauge", "Configured sleep between txn.", float64(st.Sleep))
+	metric("goc_max_lag_seconds", "gauge", "Configured max slave lag.", float64(st.MaxLag))
+	metric("goc_txn_size", "gauge", "Configured rows per txn.", float64(st.TxnSize))
+	metric("goc_slave_max_lag_seconds", "gauge", "Max lag of slaves, -1 means lag is not checked.", float64(st.SlaveMaxLag))
+
+	hosts := make([]string, 0, len(st.SlaveLags))
+	for host := range st.SlaveLags {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for i, host := range hosts {
+		tp := ""
+		if i == 0 {
+			tp = "gauge"
+		}
+		metric("goc_slave_lag_seconds", tp, "Lag of every slave, -1 means slave is removed from lag check.", float64(st.SlaveLags[host]), fmt.Sprintf(`slave=%q`, host))
+	}
+	return buf.String()
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (s *httpServer) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_ = s.server.Shutdown(ctx)
+}
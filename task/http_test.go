@@ -0,0 +1,36 @@
+package task
+
+import (
+	"strings"
+	"testing"
+
+	"go-oak-chunk/v2/vars"
+)
+
+func TestFormatMetrics(t *testing.T) {
+	st := &Status{
+		Database:   "test",
+		Table:      "t1",
+		RowAffects: 1200,
+		Chunks:     3,
+		Throttle:   vars.ThrottleMaxLag,
+		SlaveLags:  map[string]int64{"10.0.0.2:3306": 7, "10.0.0.1:3306": -1},
+	}
+
+	metrics := formatMetrics(st)
+	for _, line := range []string{
+		`goc_rows_affected_total{database="test",table="t1"} 1200`,
+		`goc_chunks_total{database="test",table="t1"} 3`,
+		`goc_throttle{database="test",table="t1",state="max-lag"} 1`,
+		`goc_throttle{database="test",table="t1",state="none"} 0`,
+		`goc_slave_lag_seconds{database="test",table="t1",slave="10.0.0.2:3306"} 7`,
+		`goc_slave_lag_seconds{database="test",table="t1",slave="10.0.0.1:3306"} -1`,
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Fatalf("metrics don't contain %q:\n%s", line, metrics)
+		}
+	}
+	if strings.Count(metrics, "# TYPE goc_slave_lag_seconds") != 1 {
+		t.Fatalf("TYPE of goc_slave_lag_seconds should be printed once:\n%s", metrics)
+	}
+}
@@ -0,0 +1,127 @@
+package task
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/log"
+	"go-oak-chunk/v2/vars"
+)
+
+// JobsReport is the combined report of jobs file
+type JobsReport struct {
+	Status     string       `json:"status"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at"`
+	Elapsed    float64      `json:"elapsed_seconds"`
+	RowAffects int64        `json:"row_affects"`
+	Jobs       []*JobReport `json:"jobs"`
+}
+
+type JobReport struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Report is nil if the job isn't started
+	Report *Report `json:"report,omitempty"`
+}
+
+// RunJobs runs the jobs in order, Parallel of them at the same time, jobs not started after a failed or interrupted
+// one are skipped. A failed job doesn't stop the jobs running in parallel with it, they finish their open txn and
+// run to the end or until ctx is done. Parallel jobs share one token bucket and the lag checker of an instance.
+// The combined report is written to ReportFile of jobs, and the report of every job to its own report_file.
+func RunJobs(ctx context.Context, jobs *conf.Jobs) error {
+	return runJobs(ctx, jobs, runTask)
+}
+
+// taskRunner runs the task of a job and returns its report, RunJobs runs runTask
+type taskRunner func(ctx context.Context, c *conf.Config, shared *sharedThrottle) (*Report, error)
+
+func runJobs(ctx context.Context, jobs *conf.Jobs, run taskRunner) error {
+	jr := &JobsReport{Status: vars.JobFinished, StartedAt: time.Now(), Jobs: make([]*JobReport, 0, len(jobs.Jobs))}
+	for _, job := range jobs.Jobs {
+		jr.Jobs = append(jr.Jobs, &JobReport{Name: job.Name, Status: vars.JobSkipped})
+	}
+
+	var shared *sharedThrottle
+	if jobs.Parallel > 1 {
+		shared = newSharedThrottle(ctx)
+	}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		err error
+	)
+	running := make(chan struct{}, max(jobs.Parallel, 1))
+	for i, job := range jobs.Jobs {
+		running <- struct{}{}
+		mu.Lock()
+		failed := err != nil
+		mu.Unlock()
+		if failed {
+			<-running
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, job *conf.Job) {
+			defer func() {
+				<-running
+				wg.Done()
+			}()
+			color.Cyan("[%d/%d] Job %s: %s\n", i+1, len(jobs.Jobs), job.Name, job.Config.ExecuteQuery)
+			report := jr.Jobs[i]
+			errJob := runJob(ctx, job, report, shared, run)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if report.Report != nil {
+				jr.RowAffects += report.Report.RowAffects
+			}
+			if errJob != nil && err == nil {
+				err = errJob
+				jr.Status = report.Status
+				log.StreamLogger.Error("job %s is %s, the jobs not started are skipped", job.Name, report.Status)
+			}
+		}(i, job)
+	}
+	wg.Wait()
+	if shared != nil {
+		shared.close()
+	}
+
+	jr.FinishedAt = time.Now()
+	jr.Elapsed = jr.FinishedAt.Sub(jr.StartedAt).Seconds()
+	if jobs.ReportFile != "" {
+		if errReport := writeReport(jobs.ReportFile, jr); errReport != nil {
+			log.StreamLogger.Error("write report file is failed, err: %v", errReport)
+		}
+	}
+	return err
+}
+
+// runJob runs one job of RunJobs and fills its report
+func runJob(ctx context.Context, job *conf.Job, report *JobReport, shared *sharedThrottle, run taskRunner) error {
+	if job.Config.DryRun {
+		err := PlanTask(ctx, job.Config)
+		report.Status, report.Error = jobStatus(err)
+		return err
+	}
+
+	r, err := run(ctx, job.Config, shared)
+	report.Status, report.Error = jobStatus(err)
+	if r != nil {
+		report.Report = r
+		if job.Config.ReportFile != "" {
+			if errReport := writeReport(job.Config.ReportFile, r); errReport != nil {
+				log.StreamLogger.Error("write report file of job %s is failed, err: %v", job.Name, errReport)
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/vars"
+)
+
+func TestRunJobsReport(t *testing.T) {
+	// the stmts have no database, they fail before connecting
+	jobs := &conf.Jobs{
+		Jobs: []*conf.Job{
+			{Name: "a", Config: &conf.Config{ExecuteQuery: "delete from t1 where id < 10"}},
+			{Name: "b", Config: &conf.Config{ExecuteQuery: "delete from t2 where id < 10"}},
+		},
+		ReportFile: filepath.Join(t.TempDir(), "report.json"),
+		Parallel:   1,
+	}
+	if err := RunJobs(context.Background(), jobs); err == nil {
+		t.Fatal("job without database should fail")
+	}
+
+	data, err := os.ReadFile(jobs.ReportFile)
+	if err != nil {
+		t.Fatalf("combined report should be written after a failed job, err: %v", err)
+	}
+	jr := &JobsReport{}
+	if err = json.Unmarshal(data, jr); err != nil {
+		t.Fatal(err)
+	}
+	if jr.Status != vars.JobFailed || jr.Jobs[0].Status != vars.JobFailed || jr.Jobs[0].Error == "" || jr.Jobs[1].Status != vars.JobSkipped {
+		t.Fatalf("got report %s", data)
+	}
+
+	// a failed job doesn't kill the jobs running in parallel with it, a fails only after b is running and b
+	// finishes after a is failed
+	jobs = &conf.Jobs{
+		Jobs: []*conf.Job{
+			{Name: "a", Config: &conf.Config{ExecuteQuery: "delete from t1 where id < 10"}},
+			{Name: "b", Config: &conf.Config{ExecuteQuery: "delete from t2 where id < 10"}},
+		},
+		ReportFile: filepath.Join(t.TempDir(), "report.json"),
+		Parallel:   2,
+	}
+	bRunning, aFailed := make(chan struct{}), make(chan struct{})
+	run := func(ctx context.Context, c *conf.Config, shared *sharedThrottle) (*Report, error) {
+		if c.ExecuteQuery == jobs.Jobs[0].Config.ExecuteQuery {
+			<-bRunning
+			defer close(aFailed)
+			return &Report{RowAffects: 1}, errors.New("job a is failed")
+		}
+		close(bRunning)
+		<-aFailed
+		return &Report{RowAffects: 10}, nil
+	}
+	if err = runJobs(context.Background(), jobs, run); err == nil {
+		t.Fatal("job a should fail")
+	}
+	if data, err = os.ReadFile(jobs.ReportFile); err != nil {
+		t.Fatal(err)
+	}
+	jr = &JobsReport{}
+	if err = json.Unmarshal(data, jr); err != nil {
+		t.Fatal(err)
+	}
+	if jr.Status != vars.JobFailed || jr.RowAffects != 11 || jr.Jobs[0].Status != vars.JobFailed ||
+		jr.Jobs[1].Status != vars.JobFinished {
+		t.Fatalf("got report %s", data)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"go-oak-chunk/v2/conf"
 	"go-oak-chunk/v2/log"
@@ -21,6 +22,7 @@ type slaveInfo struct {
 	host        string
 	lagSql      string
 	canSkip     bool
+	lag         int64
 }
 
 func NewSlaveChecker(masterClient *sql.DB, config *conf.Config) (*SlaveChecker, error) {
@@ -107,6 +109,7 @@ func (s *SlaveChecker) CheckLag() error {
 			continue
 		}
 
+		atomic.StoreInt64(&sl.lag, slaveLag)
 		log.StreamLogger.Debug("SlaveHost[%s], Seconds_Behind_Master: %d", sl.host, slaveLag)
 		if slaveLag > maxLag {
 			maxLag = slaveLag
@@ -118,6 +121,19 @@ func (s *SlaveChecker) CheckLag() error {
 	return nil
 }
 
+// Lags returns lag of every slave, -1 means the slave is removed from lag check
+func (s *SlaveChecker) Lags() map[string]int64 {
+	lags := make(map[string]int64, len(s.Slaves))
+	for _, sl := range s.Slaves {
+		if sl.canSkip {
+			lags[sl.host] = -1
+			continue
+		}
+		lags[sl.host] = atomic.LoadInt64(&sl.lag)
+	}
+	return lags
+}
+
 func (s *SlaveChecker) Close() {
 	for _, sl := range s.Slaves {
 		sl.MysqlClient.Close()
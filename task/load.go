@@ -0,0 +1,119 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/log"
+	"go-oak-chunk/v2/mysql"
+	"go-oak-chunk/v2/vars"
+)
+
+// loadChecker polls global status of the source every second. New txns wait while it's over max_load,
+// and job is aborted once it's over critical_load.
+type loadChecker struct {
+	client       *sql.DB
+	names        []string
+	maxLoad      map[string]int64
+	criticalLoad map[string]int64
+
+	mu sync.Mutex
+	// over is the variable over max_load, ex: Threads_running=60, empty if it's not
+	over string
+}
+
+// newLoadChecker returns nil if neither max_load nor critical_load is set
+func newLoadChecker(client *sql.DB, c *conf.Config) *loadChecker {
+	// they are checked by config precheck
+	maxLoad, _ := conf.ParseLoad(c.MaxLoad)
+	criticalLoad, _ := conf.ParseLoad(c.CriticalLoad)
+	if len(maxLoad) == 0 && len(criticalLoad) == 0 {
+		return nil
+	}
+
+	l := &loadChecker{client: client, maxLoad: lowerKeys(maxLoad), criticalLoad: lowerKeys(criticalLoad)}
+	seen := make(map[string]bool)
+	for _, thresholds := range []map[string]int64{l.maxLoad, l.criticalLoad} {
+		for name := range thresholds {
+			if !seen[name] {
+				seen[name] = true
+				l.names = append(l.names, name)
+			}
+		}
+	}
+	sort.Strings(l.names)
+	return l
+}
+
+// run checks the load until ctx is done or finished returns true, it returns the error of critical load
+func (l *loadChecker) run(ctx context.Context, finished func() bool) error {
+	for !finished() && ctx.Err() == nil {
+		if err := l.check(); err != nil {
+			return err
+		}
+		sleepContext(ctx, time.Second)
+	}
+	log.StreamLogger.Debug("check load is finished")
+	return nil
+}
+
+// check polls global status once, the last state is kept if it fails
+func (l *loadChecker) check() error {
+	status, err := mysql.GlobalStatus(l.client, l.names)
+	if err != nil {
+		log.StreamLogger.Error("check load got err: %v", err)
+		return nil
+	}
+	if v := exceeded(status, l.criticalLoad); v != "" {
+		return fmt.Errorf("%s is over critical_load, job is aborted", v)
+	}
+
+	over := exceeded(status, l.maxLoad)
+	if over != "" {
+		log.StreamLogger.Debug("Reach max load[%s]", over)
+	}
+	l.mu.Lock()
+	l.over = over
+	l.mu.Unlock()
+	return nil
+}
+
+// throttled returns max-load if a variable is over max_load
+func (l *loadChecker) throttled() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.over != "" {
+		return vars.ThrottleMaxLoad
+	}
+	return ""
+}
+
+// exceeded returns the first variable over its threshold by name, ex: threads_running=60 > 50
+func exceeded(status, thresholds map[string]int64) string {
+	names := make([]string, 0, len(thresholds))
+	for name := range thresholds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if v, ok := status[name]; ok && v > thresholds[name] {
+			return fmt.Sprintf("%s=%d > %d", name, v, thresholds[name])
+		}
+	}
+	return ""
+}
+
+// lowerKeys makes names of status case-insensitive, SHOW GLOBAL STATUS doesn't care about case either
+func lowerKeys(m map[string]int64) map[string]int64 {
+	lower := make(map[string]int64, len(m))
+	for k, v := range m {
+		lower[strings.ToLower(k)] = v
+	}
+	return lower
+}
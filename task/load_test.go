@@ -0,0 +1,30 @@
+package task
+
+import (
+	"testing"
+
+	"go-oak-chunk/v2/conf"
+)
+
+func TestLoadChecker(t *testing.T) {
+	if l := newLoadChecker(nil, &conf.Config{}); l != nil {
+		t.Fatal("load checker without thresholds should be nil")
+	}
+
+	l := newLoadChecker(nil, &conf.Config{MaxLoad: "Threads_running=50", CriticalLoad: "Threads_Running=200,Threads_connected=1000"})
+	if len(l.names) != 2 || l.names[0] != "threads_connected" || l.names[1] != "threads_running" {
+		t.Fatalf("got names %v", l.names)
+	}
+
+	status := map[string]int64{"threads_running": 60, "threads_connected": 100}
+	if v := exceeded(status, l.maxLoad); v != "threads_running=60 > 50" {
+		t.Fatalf("got %q over max load", v)
+	}
+	if v := exceeded(status, l.criticalLoad); v != "" {
+		t.Fatalf("got %q over critical load", v)
+	}
+	status["threads_running"] = 201
+	if v := exceeded(status, l.criticalLoad); v != "threads_running=201 > 200" {
+		t.Fatalf("got %q over critical load", v)
+	}
+}
@@ -0,0 +1,84 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/log"
+	"go-oak-chunk/v2/mysql"
+)
+
+// PlanTask walks the index the same way as RunTask, but prints every chunk instead of writing it
+func PlanTask(ctx context.Context, config *conf.Config) error {
+	w, err := mysql.NewWriter(config)
+	if err != nil {
+		return err
+	}
+	defer w.MysqlClient.Close()
+	p := mysql.NewProcedure(w)
+
+	print(color.CyanString("[Execute SQL]: "))
+	fmt.Printf("[%s]: %s\n", w.SqlType, w.ExecuteSQL)
+	print(color.CyanString("[Source]: "))
+	fmt.Printf("%s:%d\n", config.Host, config.Port)
+	print(color.CyanString("[Schema]: "))
+	fmt.Printf("%s.%s\n", w.Database, w.Table)
+	print(color.CyanString("[Unique Key]: "))
+	fmt.Printf("%s\n", strings.Join(w.UniqueKeyColumns(), ","))
+	if w.RowLimit > 0 {
+		print(color.CyanString("[Row Limit]: "))
+		fmt.Printf("%d\n", w.RowLimit)
+	}
+
+	if p.ChunkSize == 0 {
+		fmt.Println("=============================================")
+		color.Cyan("[Chunk 1] all rows in one txn")
+		execSql, _ := w.ExecStmt(&mysql.Producer{})
+		fmt.Printf("%s\n", execSql)
+		return nil
+	}
+
+	print(color.CyanString("[First SQL]: "))
+	fmt.Printf("%s\n", p.FirstSQL)
+	print(color.CyanString("[Next SQL]: "))
+	fmt.Printf("%s\n", p.NextSQL)
+	fmt.Println("=============================================")
+
+	var (
+		wg     sync.WaitGroup
+		chunks int64
+		rows   int64
+	)
+	readErrChan := make(chan error, 1)
+	wg.Add(1)
+	go func() {
+		readErrChan <- p.BuildSQL(ctx, w.ProducerQueue, &wg)
+	}()
+
+	for {
+		select {
+		case readErr := <-readErrChan:
+			if readErr != nil {
+				return readErr
+			}
+		case pr := <-w.ProducerQueue:
+			if pr.IsFinished {
+				wg.Wait()
+				color.Green("Total Chunks: %d, Rows: %d\n", chunks, rows)
+				log.StreamLogger.Debug("Plan is finished")
+				return nil
+			}
+
+			chunks++
+			rows += pr.Rows
+			execSql, values := w.ExecStmt(pr)
+			color.Cyan("[Chunk %d] rows: %d", chunks, pr.Rows)
+			fmt.Printf("%s\n", w.BindArgs(execSql, values))
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/log"
+	"go-oak-chunk/v2/mysql"
+)
+
+var errNotConfirmed = errors.New("job is not confirmed, nothing is written")
+
+// preCheck counts the rows before anything is written, asks for confirmation and sets the max affected rows of writer
+func preCheck(ctx context.Context, c *conf.Config, w *mysql.Writer) error {
+	if c.PreCount {
+		count, err := mysql.NewProcedure(w).CountRows(ctx)
+		if err != nil {
+			return fmt.Errorf("pre-count rows is failed, err: %v", err)
+		}
+		// rows affected before resume are counted too
+		w.PreCount = w.GetRowAffects() + count
+		log.StreamLogger.Debug("pre-count rows: %d", count)
+
+		if !c.AssumeYes {
+			printPreCount(os.Stdout, c, w, count)
+			if !askConfirm(os.Stdin, os.Stdout) {
+				return errNotConfirmed
+			}
+		}
+	}
+
+	w.MaxAffectedRows = maxAffectedRows(c, w.PreCount)
+	if w.MaxAffectedRows > 0 {
+		log.StreamLogger.Debug("max affected rows: %d", w.MaxAffectedRows)
+	}
+	return nil
+}
+
+func printPreCount(out io.Writer, c *conf.Config, w *mysql.Writer, count int64) {
+	fmt.Fprint(out, color.CyanString("[Execute SQL]: "))
+	fmt.Fprintf(out, "[%s]: %s\n", w.SqlType, w.ExecuteSQL)
+	fmt.Fprint(out, color.CyanString("[Schema]: "))
+	fmt.Fprintf(out, "%s.%s on %s:%d\n", w.Database, w.Table, c.Host, c.Port)
+	fmt.Fprint(out, color.CyanString("[Unique Key]: "))
+	fmt.Fprintf(out, "%s\n", strings.Join(w.UniqueKeyColumns(), ","))
+	fmt.Fprint(out, color.CyanString("[Matched Rows]: "))
+	fmt.Fprintf(out, "%d\n", count)
+}
+
+// askConfirm returns true only if `yes` is typed
+func askConfirm(in io.Reader, out io.Writer) bool {
+	fmt.Fprint(out, color.YellowString("Type 'yes' to continue: "))
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return false
+	}
+	return strings.TrimSpace(line) == "yes"
+}
+
+// maxAffectedRows returns the smaller one of max_affected_rows and pre-count * (1 + max_affected_percent%), 0 means no limit
+func maxAffectedRows(c *conf.Config, preCount int64) int64 {
+	maxRows := c.MaxAffectedRows
+	if c.MaxAffectedPercent > 0 {
+		byPercent := int64(float64(preCount) * (1 + c.MaxAffectedPercent/100))
+		// 0 means no limit, at least 1 row is allowed when nothing is matched
+		if byPercent < 1 {
+			byPercent = 1
+		}
+		if maxRows == 0 || byPercent < maxRows {
+			maxRows = byPercent
+		}
+	}
+	return maxRows
+}
@@ -0,0 +1,45 @@
+package task
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"go-oak-chunk/v2/conf"
+)
+
+func TestAskConfirm(t *testing.T) {
+	cases := map[string]bool{
+		"yes\n":   true,
+		" yes \n": true,
+		"yes":     true,
+		"y\n":     false,
+		"":        false,
+		"no\n":    false,
+	}
+	for input, expected := range cases {
+		if askConfirm(strings.NewReader(input), io.Discard) != expected {
+			t.Fatalf("input %q should be %v", input, expected)
+		}
+	}
+}
+
+func TestMaxAffectedRows(t *testing.T) {
+	cases := []struct {
+		config   *conf.Config
+		preCount int64
+		expected int64
+	}{
+		{&conf.Config{}, 1000, 0},
+		{&conf.Config{MaxAffectedRows: 500}, 1000, 500},
+		{&conf.Config{MaxAffectedPercent: 10}, 1000, 1100},
+		{&conf.Config{MaxAffectedRows: 1050, MaxAffectedPercent: 10}, 1000, 1050},
+		{&conf.Config{MaxAffectedRows: 5000, MaxAffectedPercent: 10}, 1000, 1100},
+		{&conf.Config{MaxAffectedPercent: 10}, 0, 1},
+	}
+	for _, c := range cases {
+		if n := maxAffectedRows(c.config, c.preCount); n != c.expected {
+			t.Fatalf("%+v got %d, expected %d", c.config, n, c.expected)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/mysql"
+	"go-oak-chunk/v2/vars"
+)
+
+// progress event
+const (
+	progressStart    = "start"
+	progressProgress = "progress"
+	progressDone     = "done"
+)
+
+// progressEvent is one line of plain or json progress
+type progressEvent struct {
+	Time       string            `json:"time"`
+	Event      string            `json:"event"`
+	SqlType    string            `json:"sql_type,omitempty"`
+	ExecuteSQL string            `json:"execute_sql,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	Database   string            `json:"database"`
+	Table      string            `json:"table"`
+	RowAffects int64             `json:"row_affects"`
+	Chunks     int64             `json:"chunks"`
+	Elapsed    float64           `json:"elapsed_seconds"`
+	Percent    float64           `json:"percent"`
+	RowRate    float64           `json:"rows_per_second"`
+	ETA        float64           `json:"eta_seconds"`
+	Throttle   string            `json:"throttle"`
+	LastKey    []*mysql.KeyValue `json:"last_key"`
+}
+
+// progressFormat returns format if it's specified, otherwise tui when out is a terminal and plain when it's not,
+// so that cron, kubernetes and ci logs are not messed up by ansi escapes
+func progressFormat(format string, out *os.File) string {
+	if format != "" {
+		return format
+	}
+	if fi, err := out.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		return vars.ProgressFormatTUI
+	}
+	return vars.ProgressFormatPlain
+}
+
+// printProgressLines prints one plain line or json object every interval, and the summary when ctx is done
+func printProgressLines(out io.Writer, format string, config *conf.Config, writer *mysql.Writer, est *estimator, interval time.Duration, ctx context.Context, doneChan chan struct{}) {
+	start := time.Now()
+	emit := func(kind string) {
+		ev := newProgressEvent(kind, config, writer, est, start, time.Now())
+		if format == vars.ProgressFormatJSON {
+			b, _ := json.Marshal(ev)
+			fmt.Fprintln(out, string(b))
+		} else {
+			fmt.Fprintln(out, ev.plain())
+		}
+	}
+
+	emit(progressStart)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			emit(progressDone)
+			doneChan <- struct{}{}
+			return
+		case <-ticker.C:
+			emit(progressProgress)
+		}
+	}
+}
+
+func newProgressEvent(kind string, config *conf.Config, writer *mysql.Writer, est *estimator, start, now time.Time) *progressEvent {
+	elapsed := now.Sub(start)
+	ev := &progressEvent{
+		Time:       now.Format("2006-01-02 15:04:05"),
+		Event:      kind,
+		Database:   writer.Database,
+		Table:      writer.Table,
+		RowAffects: writer.GetRowAffects(),
+		Chunks:     writer.GetChunks(),
+		Elapsed:    elapsed.Truncate(time.Second).Seconds(),
+		ETA:        -1,
+		Throttle:   writer.Throttle(),
+		LastKey:    writer.LastKeyValues(),
+	}
+	if kind == progressStart {
+		ev.SqlType = writer.SqlType
+		ev.ExecuteSQL = writer.ExecuteSQL
+		ev.Source = config.Host + ":" + strconv.Itoa(config.Port)
+	}
+
+	estimate := est.estimate(writer, now)
+	ev.Percent = estimate.Percent
+	ev.RowRate = estimate.RowRate
+	if estimate.ETA >= 0 {
+		ev.ETA = estimate.ETA.Seconds()
+	}
+	// average speed of the whole job when it's done
+	if kind == progressDone && elapsed > 0 {
+		ev.RowRate = float64(ev.RowAffects) / elapsed.Seconds()
+	}
+	return ev
+}
+
+// plain is a log line of key=value, ex:
+// 2024-01-01 12:00:00 [progress] db.t rows=1000 chunks=10 elapsed=3s percent=12.00% rows/s=333.33 eta=1m0s throttle=none last_key=(id=1000)
+func (ev *progressEvent) plain() string {
+	est := Estimate{Percent: ev.Percent, ETA: -1}
+	if ev.ETA >= 0 {
+		est.ETA = time.Duration(ev.ETA * float64(time.Second))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s [%s] %s.%s", ev.Time, ev.Event, ev.Database, ev.Table)
+	if ev.Event == progressStart {
+		fmt.Fprintf(&b, " source=%s type=%s sql=%q", ev.Source, ev.SqlType, ev.ExecuteSQL)
+		return b.String()
+	}
+	fmt.Fprintf(&b, " rows=%d chunks=%d elapsed=%s percent=%s rows/s=%.2f",
+		ev.RowAffects, ev.Chunks, time.Duration(ev.Elapsed*float64(time.Second)).String(), est.percentString(), ev.RowRate)
+	if ev.Event == progressProgress {
+		fmt.Fprintf(&b, " eta=%s throttle=%s", est.etaString(), ev.Throttle)
+	}
+	fmt.Fprintf(&b, " last_key=%s", mysql.KeyValuesString(ev.LastKey))
+	return b.String()
+}
@@ -0,0 +1,52 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-oak-chunk/v2/mysql"
+	"go-oak-chunk/v2/vars"
+)
+
+func TestProgressFormat(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if format := progressFormat("", f); format != vars.ProgressFormatPlain {
+		t.Fatalf("stdout redirected to a file should be plain, got %s", format)
+	}
+	if format := progressFormat(vars.ProgressFormatJSON, f); format != vars.ProgressFormatJSON {
+		t.Fatalf("specified format should be kept, got %s", format)
+	}
+}
+
+func TestProgressEventPlain(t *testing.T) {
+	ev := &progressEvent{
+		Time:       "2024-01-01 12:00:00",
+		Event:      progressProgress,
+		Database:   "db",
+		Table:      "t",
+		RowAffects: 1000,
+		Chunks:     10,
+		Elapsed:    3,
+		Percent:    12,
+		RowRate:    333.333,
+		ETA:        60,
+		Throttle:   vars.ThrottleNone,
+		LastKey:    []*mysql.KeyValue{{ColumnName: "id", ColumnValue: 1000}},
+	}
+	expected := "2024-01-01 12:00:00 [progress] db.t rows=1000 chunks=10 elapsed=3s percent=12.00% rows/s=333.33 eta=1m0s throttle=none last_key=(id=1000)"
+	if line := ev.plain(); line != expected {
+		t.Fatalf("got %s", line)
+	}
+
+	ev.Event, ev.Percent, ev.ETA = progressDone, -1, -1
+	expected = "2024-01-01 12:00:00 [done] db.t rows=1000 chunks=10 elapsed=3s percent=- rows/s=333.33 last_key=(id=1000)"
+	if line := ev.plain(); line != expected {
+		t.Fatalf("got %s", line)
+	}
+}
@@ -0,0 +1,133 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/mysql"
+	"go-oak-chunk/v2/vars"
+)
+
+// Report is written to report_file as json when job returns, to be attached to change tickets
+type Report struct {
+	JobId      string            `json:"job_id,omitempty"`
+	Status     string            `json:"status"`
+	Error      string            `json:"error,omitempty"`
+	Host       string            `json:"host"`
+	Port       int               `json:"port"`
+	Database   string            `json:"database"`
+	Table      string            `json:"table"`
+	SqlType    string            `json:"sql_type"`
+	ExecuteSQL string            `json:"execute_sql"`
+	UniqueKey  []string          `json:"unique_key"`
+	StartKey   []*mysql.KeyValue `json:"start_key"`
+	EndKey     []*mysql.KeyValue `json:"end_key"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	Elapsed    float64           `json:"elapsed_seconds"`
+	RowAffects int64             `json:"row_affects"`
+	Chunks     int64             `json:"chunks"`
+	Txns       int64             `json:"txns"`
+	Retries    int64             `json:"retries"`
+	// Throttled is seconds waited for sleep, lag, max-lag, paused, out of window, max-load and custom throttles
+	Throttled    map[string]float64 `json:"throttled_seconds"`
+	MaxSlaveLag  int64              `json:"max_slave_lag"`
+	ChunkLatency *LatencyReport     `json:"chunk_latency_seconds"`
+	// Verify is the result of verify, nil if it's not enabled
+	Verify *VerifyResult `json:"verify,omitempty"`
+}
+
+// LatencyReport is percentiles of chunk execution time in seconds
+type LatencyReport struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+func newReport(c *conf.Config, w *mysql.Writer, startedAt, finishedAt time.Time, err error) *Report {
+	stats := w.RunStats()
+	r := &Report{
+		JobId:      c.JobId,
+		Host:       c.Host,
+		Port:       c.Port,
+		Database:   w.Database,
+		Table:      w.Table,
+		SqlType:    w.SqlType,
+		ExecuteSQL: w.ExecuteSQL,
+		UniqueKey:  w.UniqueKeyColumns(),
+		StartKey:   stats.StartKey,
+		EndKey:     w.LastKeyValues(),
+		StartedAt:  startedAt,
+		FinishedAt: finishedAt,
+		Elapsed:    finishedAt.Sub(startedAt).Seconds(),
+		RowAffects: w.GetRowAffects(),
+		Chunks:     w.GetChunks(),
+		Txns:       stats.Txns,
+		Retries:    stats.Retries,
+		Throttled: map[string]float64{
+			vars.ThrottleSleep:    0,
+			vars.ThrottleLag:      0,
+			vars.ThrottleMaxLag:   0,
+			vars.ThrottlePaused:   0,
+			vars.ThrottleWindow:   0,
+			vars.ThrottleMaxLoad:  0,
+			vars.ThrottleQuery:    0,
+			vars.ThrottleFlagFile: 0,
+			vars.ThrottleHTTP:     0,
+		},
+		MaxSlaveLag:  stats.MaxSlaveLag,
+		ChunkLatency: latencyReport(stats.ChunkLatencies),
+	}
+	for state, d := range stats.Throttled {
+		r.Throttled[state] = d.Seconds()
+	}
+	r.Status, r.Error = jobStatus(err)
+	return r
+}
+
+// jobStatus returns finished, interrupted or failed with the error by the error job returns
+func jobStatus(err error) (string, string) {
+	switch {
+	case err == nil:
+		return vars.JobFinished, ""
+	case errors.Is(err, context.Canceled):
+		return vars.JobInterrupted, ""
+	default:
+		return vars.JobFailed, err.Error()
+	}
+}
+
+// latencyReport returns nearest-rank percentiles of sorted latencies
+func latencyReport(sorted []time.Duration) *LatencyReport {
+	if len(sorted) == 0 {
+		return &LatencyReport{}
+	}
+	percentile := func(p int) float64 {
+		rank := (p*len(sorted) + 99) / 100
+		if rank < 1 {
+			rank = 1
+		}
+		return sorted[rank-1].Seconds()
+	}
+	return &LatencyReport{
+		P50: percentile(50),
+		P90: percentile(90),
+		P95: percentile(95),
+		P99: percentile(99),
+		Max: sorted[len(sorted)-1].Seconds(),
+	}
+}
+
+func writeReport(path string, r any) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
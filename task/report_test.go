@@ -0,0 +1,27 @@
+package task
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyReport(t *testing.T) {
+	if r := latencyReport(nil); *r != (LatencyReport{}) {
+		t.Fatalf("empty latencies should be zero, got %+v", r)
+	}
+
+	sorted := make([]time.Duration, 0, 100)
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	r := latencyReport(sorted)
+	expected := LatencyReport{P50: 0.05, P90: 0.09, P95: 0.095, P99: 0.099, Max: 0.1}
+	if *r != expected {
+		t.Fatalf("got %+v", r)
+	}
+
+	r = latencyReport([]time.Duration{time.Second})
+	if r.P50 != 1 || r.P99 != 1 || r.Max != 1 {
+		t.Fatalf("got %+v", r)
+	}
+}
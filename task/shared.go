@@ -0,0 +1,117 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/ratelimit"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/log"
+	"go-oak-chunk/v2/mysql"
+	"go-oak-chunk/v2/task/lag_checker"
+)
+
+// lagChecker checks slave lag every 800ms in background, it stops checking at the first error
+type lagChecker struct {
+	sl *lag_checker.SlaveChecker
+	// shared is true if it's shared by parallel jobs or workers, it's run for all of them instead of by getStopTime
+	shared  bool
+	maxLag  int64
+	failed  atomic.Bool
+	running atomic.Bool
+}
+
+// run checks slave lag until ctx is done or finished returns true
+func (l *lagChecker) run(ctx context.Context, finished func() bool) {
+	l.running.Store(true)
+	defer l.running.Store(false)
+	for l.sl != nil && !finished() && ctx.Err() == nil {
+		log.StreamLogger.Debug("start to get slave check lag")
+		if err := l.sl.CheckLag(); err != nil {
+			log.StreamLogger.Error("slave check lag got err: %v", err)
+			l.failed.Store(true)
+			break
+		}
+		atomic.StoreInt64(&l.maxLag, l.sl.MaxLag)
+		sleepContext(ctx, 800*time.Millisecond)
+	}
+	log.StreamLogger.Debug("get slave check lag is finished")
+}
+
+// standalone returns the checker for txns run after the workers of job, the shared checker of workers stops with them
+// and its last lag is stale. It's l itself if l is still running for parallel jobs, or l isn't shared.
+func (l *lagChecker) standalone() *lagChecker {
+	if !l.shared || l.running.Load() {
+		return l
+	}
+	return &lagChecker{sl: l.sl}
+}
+
+// lag returns the max slave lag, ok is false if there is no slave checker or it got an error
+func (l *lagChecker) lag() (lag int64, ok bool) {
+	if l.sl == nil || l.failed.Load() {
+		return 0, false
+	}
+	return atomic.LoadInt64(&l.maxLag), true
+}
+
+// sharedThrottle is shared by the jobs running in parallel. All of them take tokens from one bucket,
+// so the combined write rate is the same as one job, and the jobs on the same instance share one lag checker,
+// so slaves are queried once for all of them.
+type sharedThrottle struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	bucket   *ratelimit.Bucket
+	mu       sync.Mutex
+	checkers map[string]*lagChecker
+	wg       sync.WaitGroup
+}
+
+func newSharedThrottle(ctx context.Context) *sharedThrottle {
+	ctx, cancel := context.WithCancel(ctx)
+	return &sharedThrottle{
+		ctx:      ctx,
+		cancel:   cancel,
+		bucket:   ratelimit.NewBucketWithQuantum(1*time.Millisecond, 1, 1),
+		checkers: make(map[string]*lagChecker),
+	}
+}
+
+// lagChecker returns the lag checker of the instance of c, it's created by the first job on the instance
+func (s *sharedThrottle) lagChecker(c *conf.Config, w *mysql.Writer) *lagChecker {
+	key := fmt.Sprintf("%s:%d include=%s exclude=%s", c.Host, c.Port, c.IncludeSlaves, c.ExcludeSlaves)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.checkers[key]; ok {
+		return l
+	}
+
+	// slaves are found by the connection of the job, the checker has its own connections to them
+	sl, err := lag_checker.NewSlaveChecker(w.MysqlClient, c)
+	if err != nil {
+		log.StreamLogger.Error("create SlaveChecker goroutine is failed, err: %v", err)
+	}
+	l := &lagChecker{sl: sl, shared: true}
+	s.checkers[key] = l
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		l.run(s.ctx, func() bool { return false })
+	}()
+	return l
+}
+
+// close stops the lag checkers and closes their connections after all jobs return
+func (s *sharedThrottle) close() {
+	s.cancel()
+	s.wg.Wait()
+	for _, l := range s.checkers {
+		if l.sl != nil {
+			l.sl.Close()
+		}
+	}
+}
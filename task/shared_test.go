@@ -0,0 +1,57 @@
+package task
+
+import (
+	"context"
+	"testing"
+
+	"go-oak-chunk/v2/task/lag_checker"
+)
+
+func TestLagChecker(t *testing.T) {
+	// sleep is used without slave checker
+	l := &lagChecker{}
+	l.run(context.Background(), func() bool { return false })
+	if _, ok := l.lag(); ok {
+		t.Fatal("lag without slave checker should not be ok")
+	}
+
+	l = &lagChecker{sl: &lag_checker.SlaveChecker{}, maxLag: 3}
+	if lag, ok := l.lag(); !ok || lag != 3 {
+		t.Fatalf("got lag %d, %v", lag, ok)
+	}
+	l.failed.Store(true)
+	if _, ok := l.lag(); ok {
+		t.Fatal("lag of failed checker should not be ok")
+	}
+}
+
+func TestLagCheckerStandalone(t *testing.T) {
+	// checker of workers stopped with them, its last lag is stale
+	l := &lagChecker{sl: &lag_checker.SlaveChecker{}, shared: true, maxLag: 30}
+	if s := l.standalone(); s == l || s.shared || s.sl != l.sl {
+		t.Fatal("txns after workers should check slave lag by their own checker")
+	}
+	l.running.Store(true)
+	if l.standalone() != l {
+		t.Fatal("running checker of parallel jobs should be shared")
+	}
+	l = &lagChecker{}
+	if l.standalone() != l {
+		t.Fatal("checker which isn't shared is run by getStopTime")
+	}
+}
+
+func TestSharedThrottleClose(t *testing.T) {
+	s := newSharedThrottle(context.Background())
+	l := &lagChecker{shared: true}
+	s.checkers["127.0.0.1:3306"] = l
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		l.run(s.ctx, func() bool { return false })
+	}()
+	s.close()
+	if s.ctx.Err() == nil {
+		t.Fatal("lag checkers should be stopped")
+	}
+}
@@ -0,0 +1,79 @@
+package task
+
+import (
+	"time"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/mysql"
+	"go-oak-chunk/v2/task/lag_checker"
+)
+
+// Status is a snapshot of a running job, shown by control socket and http endpoint
+type Status struct {
+	SqlType     string            `json:"sql_type"`
+	ExecuteSQL  string            `json:"execute_sql"`
+	Database    string            `json:"database"`
+	Table       string            `json:"table"`
+	UniqueKey   []string          `json:"unique_key"`
+	LastKey     []*mysql.KeyValue `json:"last_key"`
+	RowAffects  int64             `json:"row_affects"`
+	Chunks      int64             `json:"chunks"`
+	Elapsed     float64           `json:"elapsed_seconds"`
+	RowRate     float64           `json:"rows_per_second"`
+	ChunkRate   float64           `json:"chunks_per_second"`
+	RecentRate  float64           `json:"recent_rows_per_second"`
+	Percent     float64           `json:"percent"`
+	ETA         float64           `json:"eta_seconds"`
+	CostTime    float64           `json:"last_txn_seconds"`
+	Paused      bool              `json:"paused"`
+	Throttle    string            `json:"throttle"`
+	Sleep       int64             `json:"sleep"`
+	MaxLag      int64             `json:"max_lag"`
+	TxnSize     int64             `json:"txn_size"`
+	SlaveMaxLag int64             `json:"slave_max_lag"`
+	SlaveLags   map[string]int64  `json:"slave_lags"`
+	Finished    bool              `json:"finished"`
+}
+
+func buildStatus(c *conf.Config, w *mysql.Writer, sl *lag_checker.SlaveChecker, est *estimator) *Status {
+	elapsed := time.Since(w.StartTime).Seconds()
+	s := &Status{
+		SqlType:     w.SqlType,
+		ExecuteSQL:  w.ExecuteSQL,
+		Database:    w.Database,
+		Table:       w.Table,
+		UniqueKey:   w.UniqueKeyColumns(),
+		LastKey:     w.LastKeyValues(),
+		RowAffects:  w.GetRowAffects(),
+		Chunks:      w.GetChunks(),
+		Elapsed:     elapsed,
+		CostTime:    w.GetCostTime().Seconds(),
+		Paused:      w.IsPaused(),
+		Throttle:    w.Throttle(),
+		Sleep:       c.GetSleep(),
+		MaxLag:      c.GetMaxLag(),
+		TxnSize:     w.GetTxnSize(),
+		Percent:     -1,
+		ETA:         -1,
+		SlaveMaxLag: -1,
+		SlaveLags:   make(map[string]int64),
+		Finished:    w.IsFinished,
+	}
+	if elapsed > 0 {
+		s.RowRate = float64(s.RowAffects) / elapsed
+		s.ChunkRate = float64(s.Chunks) / elapsed
+	}
+	if est != nil {
+		estimate := est.estimate(w, time.Now())
+		s.RecentRate = estimate.RowRate
+		s.Percent = estimate.Percent
+		if estimate.ETA >= 0 {
+			s.ETA = estimate.ETA.Seconds()
+		}
+	}
+	if sl != nil {
+		s.SlaveMaxLag = sl.MaxLag
+		s.SlaveLags = sl.Lags()
+	}
+	return s
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"os"
 	"sync"
 	"time"
 
@@ -20,51 +21,207 @@ import (
 	"go-oak-chunk/v2/vars"
 )
 
-func RunTask(config *conf.Config) error {
+// RunTask runs chunk dml until it is finished or ctx is done.
+// When ctx is done, the open txn is finished, the checkpoint is saved and ctx.Err() is returned.
+func RunTask(ctx context.Context, config *conf.Config) error {
+	report, err := runTask(ctx, config, nil)
+	if config.ReportFile != "" && report != nil {
+		if errReport := writeReport(config.ReportFile, report); errReport != nil {
+			log.StreamLogger.Error("write report file is failed, err: %v", errReport)
+		}
+	}
+	return err
+}
+
+// runTask is RunTask which returns the report of the run, report is nil if the job isn't started.
+// The token bucket and lag checker of shared are used instead of its own ones if it's not nil.
+func runTask(ctx context.Context, config *conf.Config, shared *sharedThrottle) (report *Report, err error) {
 	// print json of config
 	configJson, err := json.Marshal(&config)
 	if err == nil {
 		log.StreamLogger.Debug("config json: %s", string(configJson))
 	}
 
-	var wg sync.WaitGroup
+	var (
+		wg sync.WaitGroup
+		// running is done when all goroutines exit, wg is done only when they finish successfully
+		running sync.WaitGroup
+	)
 	bucketNum := make(chan int64, 1000)
 	bucket := ratelimit.NewBucketWithQuantum(1*time.Millisecond, 1, 1)
+	// abort by control socket is the same as SIGINT/SIGTERM
+	ctx, abort := context.WithCancel(ctx)
+	defer abort()
+	taskCtx, cancelTask := context.WithCancel(ctx)
+	defer cancelTask()
 
 	// 1. 创建执行SQL的协程
 	// 包含预检查
-	w := mysql.NewWriter(config)
+	w, err := mysql.NewWriter(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// count rows and ask for confirmation before anything is written
+	if err = preCheck(ctx, config, w); err != nil {
+		Close(nil, w, bucketNum)
+		return nil, err
+	}
+	if err = w.Open(config); err != nil {
+		Close(nil, w, bucketNum)
+		return nil, err
+	}
+	est := newEstimator(w)
 
 	// 2. 检查是否要创建检查slaveLag的协程
 	// 3. 检查是否要创建检查mysqlio延迟的协程
-	sl, err := lag_checker.NewSlaveChecker(w.MysqlClient, config)
-	if err != nil {
+	lc := &lagChecker{}
+	if shared != nil {
+		lc = shared.lagChecker(config, w)
+		bucket = shared.bucket
+	} else if lc.sl, err = lag_checker.NewSlaveChecker(w.MysqlClient, config); err != nil {
 		log.StreamLogger.Error("create SlaveChecker goroutine is failed, err: %v", err)
 	}
+	// sl is closed with the job, the shared one is closed after all jobs return
+	var sl *lag_checker.SlaveChecker
+	if shared == nil {
+		sl = lc.sl
+	}
 
-	wg.Add(1)
-	go func() {
-		getStopTime(sl, bucketNum, config, w)
-		log.StreamLogger.Debug("getStopTime goroutine is finished")
-		wg.Done()
-	}()
+	// every worker walks its own range of the leading key column
+	writers := []*mysql.Writer{w}
+	if config.Workers > 1 {
+		if writers, err = newWorkers(w, int(config.Workers)); err != nil {
+			Close(sl, w, bucketNum)
+			return nil, fmt.Errorf("split key range for workers is failed, err: %v", err)
+		}
+		if len(writers) > 1 {
+			// the last key of a worker isn't the progress of the job, percent is known only with pre-count
+			est.hasRange = false
+		}
+	}
 
-	// 4. read
-	readErrChan := make(chan error)
-	p := mysql.NewProcedure(w)
-	wg.Add(1)
-	go func() {
-		// equals to read goroutine
-		readErrChan <- p.BuildSQL(w.ProducerQueue, &wg)
+	var verifyResult *VerifyResult
+	startedAt := time.Now()
+	defer func() {
+		report = newReport(config, w, startedAt, time.Now(), err)
+		report.Verify = verifyResult
 	}()
 
-	// 5. write
-	writeErrChan := make(chan error)
-	wg.Add(1)
-	go func() {
-		// write goroutine
-		writeErrChan <- w.Write(bucket, bucketNum, &wg)
-	}()
+	if config.ControlSocket != "" {
+		control, err := startControlServer(config.ControlSocket, config, w, lc.sl, est, abort)
+		if err != nil {
+			Close(sl, w, bucketNum)
+			return nil, fmt.Errorf("start control socket is failed, err: %v", err)
+		}
+		defer control.Close()
+	}
+
+	if config.HTTPAddr != "" {
+		server, err := startHTTPServer(config.HTTPAddr, func() *Status { return buildStatus(config, w, lc.sl, est) })
+		if err != nil {
+			Close(sl, w, bucketNum)
+			return nil, fmt.Errorf("start http server is failed, err: %v", err)
+		}
+		defer server.Close()
+	}
+
+	// over critical_load before anything is written
+	load := newLoadChecker(w.MysqlClient, config)
+	if load != nil {
+		if err = load.check(); err != nil {
+			Close(sl, w, bucketNum)
+			return nil, err
+		}
+	}
+	// custom throttles are checked before the first txn, so that the job waits if the flag file already exists
+	custom := newCustomThrottler(w.MysqlClient, config)
+	if custom != nil {
+		custom.check(taskCtx)
+	}
+
+	// slaves are checked once for all workers
+	if len(writers) > 1 && !lc.shared {
+		lc.shared = true
+		wg.Add(1)
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			lc.run(taskCtx, func() bool { return workersFinished(writers) })
+			wg.Done()
+		}()
+	}
+
+	loadErrChan := make(chan error, 1)
+	if load != nil {
+		wg.Add(1)
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			if errLoad := load.run(taskCtx, func() bool { return workersFinished(writers) }); errLoad != nil {
+				loadErrChan <- errLoad
+				return
+			}
+			wg.Done()
+		}()
+	}
+
+	var throttlers []throttler
+	if load != nil {
+		throttlers = append(throttlers, load)
+	}
+	if custom != nil {
+		throttlers = append(throttlers, custom)
+		wg.Add(1)
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			custom.run(taskCtx, func() bool { return workersFinished(writers) })
+			wg.Done()
+		}()
+	}
+
+	readErrChan := make(chan error, len(writers))
+	writeErrChan := make(chan error, len(writers))
+	for i, ww := range writers {
+		// every worker has its own tokens, the bucket is shared only by parallel jobs
+		wwBucket, wwBucketNum := bucket, bucketNum
+		if i > 0 {
+			wwBucketNum = make(chan int64, 1000)
+			if shared == nil {
+				wwBucket = ratelimit.NewBucketWithQuantum(1*time.Millisecond, 1, 1)
+			}
+		}
+
+		wg.Add(1)
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			getStopTime(taskCtx, lc, throttlers, wwBucketNum, config, ww, func() bool { return ww.IsFinished })
+			log.StreamLogger.Debug("getStopTime goroutine is finished")
+			wg.Done()
+		}()
+
+		// 4. read
+		p := mysql.NewProcedure(ww)
+		p.LimitByWriter(ww)
+		wg.Add(1)
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			// equals to read goroutine
+			readErrChan <- p.BuildSQL(taskCtx, ww.ProducerQueue, &wg)
+		}()
+
+		// 5. write
+		wg.Add(1)
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			// write goroutine
+			writeErrChan <- ww.Write(taskCtx, wwBucket, wwBucketNum, &wg)
+		}()
+	}
 
 	tasksDoneChan := make(chan struct{})
 	go func() {
@@ -73,31 +230,55 @@ func RunTask(config *conf.Config) error {
 	}()
 
 	// 6. if verbose
-	ctx, cancel := context.WithCancel(context.Background())
+	progressCtx, cancel := context.WithCancel(context.Background())
 	printProgressDoneChan := make(chan struct{})
 	if config.PrintProgress {
-		go PrintProgress(config, w, 3*time.Second, ctx, printProgressDoneChan)
+		go PrintProgress(config, w, est, time.Duration(config.ProgressInterval)*time.Second, progressCtx, printProgressDoneChan)
+	}
+
+	// stop tells all goroutines to stop, and waits until the open txn is finished
+	stop := func(taskErr error) error {
+		cancelTask()
+		running.Wait()
+		Close(sl, w, bucketNum)
+		cancel()
+		if config.PrintProgress {
+			<-printProgressDoneChan
+		}
+
+		if ctx.Err() != nil {
+			color.Yellow("Interrupted! Total Processed Rows: %d, last committed key: %v\n",
+				w.GetRowAffects(), mysql.KeyValuesString(w.LastKeyValues()))
+			return ctx.Err()
+		}
+		return taskErr
 	}
 
 	for {
 		select {
 		case readErr := <-readErrChan:
 			if readErr != nil {
-				Close(sl, w, bucketNum)
-				cancel()
-				return readErr
+				return nil, stop(readErr)
 			} else {
 				continue
 			}
 		case writeErr := <-writeErrChan:
 			if writeErr != nil {
-				Close(sl, w, bucketNum)
-				cancel()
-				return writeErr
+				return nil, stop(writeErr)
 			} else {
 				continue
 			}
+		case loadErr := <-loadErrChan:
+			// the open txn is finished before abort
+			return nil, stop(loadErr)
 		case <-tasksDoneChan:
+			// writer of the job isn't run itself when the workers run its ranges
+			w.IsFinished = true
+			// look for the rows left by concurrent writes before connections are closed
+			var errVerify error
+			if config.Verify {
+				verifyResult, errVerify = verify(ctx, config, w, lc)
+			}
 			Close(sl, w, bucketNum)
 			// tell PrintProgress to stop
 			cancel()
@@ -105,67 +286,110 @@ func RunTask(config *conf.Config) error {
 			if config.PrintProgress {
 				<-printProgressDoneChan
 			}
-			return nil
+			return nil, errVerify
 		}
 	}
 }
 
-func getStopTime(sl *lag_checker.SlaveChecker, bucketNum chan int64, c *conf.Config, w *mysql.Writer) {
-	var (
-		slaveWg  sync.WaitGroup
-		errSalve error
-	)
+// getStopTime sends the tokens of the next txn of w to bucketNum until finished returns true or ctx is done
+func getStopTime(ctx context.Context, lc *lagChecker, throttlers []throttler, bucketNum chan int64, c *conf.Config, w *mysql.Writer, finished func() bool) {
+	// correct is adjusted by every getStopTime of workers on its own
+	correct := c.Correct
+	// the shared lag checker is run for all parallel jobs or workers
+	if !lc.shared {
+		var slaveWg sync.WaitGroup
+		slaveWg.Add(1)
+		go func() {
+			lc.run(ctx, finished)
+			slaveWg.Done()
+		}()
+		defer slaveWg.Wait()
+	}
 
-	slaveWg.Add(1)
-	go func() {
-		for !w.IsFinished && sl != nil {
-			log.StreamLogger.Debug("start to get slave check lag")
-			errSalve = sl.CheckLag()
-			if errSalve != nil {
-				log.StreamLogger.Error("slave check lag got err: %v", errSalve)
-				break
+	for !finished() && ctx.Err() == nil {
+		var token int64
+		// paused by control socket
+		if w.IsPaused() {
+			w.SetThrottle(vars.ThrottlePaused)
+			if len(bucketNum) < 500 {
+				bucketNum <- vars.LagThreshold
 			}
-			time.Sleep(800 * time.Millisecond)
+			sleepContext(ctx, 800*time.Millisecond)
+			continue
+		}
+		// writer waits for the next maintenance window
+		if !w.InWindow(time.Now()) {
+			w.SetThrottle(vars.ThrottleWindow)
+			sleepContext(ctx, 800*time.Millisecond)
+			continue
+		}
+		// source is over max_load, or throttled by throttle_query, throttle_flag_file or throttle_http
+		if state := firstThrottled(throttlers); state != "" {
+			w.SetThrottle(state)
+			if len(bucketNum) < 500 {
+				bucketNum <- vars.LagThreshold
+			}
+			sleepContext(ctx, 800*time.Millisecond)
+			continue
 		}
-		log.StreamLogger.Debug("get slave check lag is finished")
-		slaveWg.Done()
-	}()
 
-	for !w.IsFinished {
-		var token int64
-		if errSalve != nil || sl == nil {
+		if lag, ok := lc.lag(); !ok {
 			token = bucketErrHandle(c)
+			w.SetThrottle(throttleState(token, 0))
 		} else {
-			log.StreamLogger.Debug("sl.MaxLag: %d", sl.MaxLag)
-			if sl.MaxLag >= c.MaxLag && c.MaxLag > 0 {
-				log.StreamLogger.Debug("Reach maxLag Threshold[MaxLag: %d,throttle: %d]", sl.MaxLag, c.MaxLag)
-				c.Correct += 50
+			log.StreamLogger.Debug("sl.MaxLag: %d", lag)
+			w.ObserveSlaveLag(lag)
+			if maxLag := c.GetMaxLag(); lag >= maxLag && maxLag > 0 {
+				log.StreamLogger.Debug("Reach maxLag Threshold[MaxLag: %d,throttle: %d]", lag, maxLag)
+				w.SetThrottle(vars.ThrottleMaxLag)
+				correct += 50
 
 				// 增加一个防止chan的容量达到上限的机制 at 2024-03-07
 				if len(bucketNum) < 500 {
 					bucketNum <- vars.LagThreshold
 				}
-				time.Sleep(800 * time.Millisecond)
+				sleepContext(ctx, 800*time.Millisecond)
 				continue
 			}
 
-			token = bucketHandle(sl.MaxLag, c)
+			token = bucketHandle(lag, c)
+			w.SetThrottle(throttleState(token, lag))
 		}
-		log.StreamLogger.Debug("bucketNum: %d", token+c.Correct)
+		log.StreamLogger.Debug("bucketNum: %d", token+correct)
 		log.StreamLogger.Debug("len of bucketNum: %d", len(bucketNum))
-		log.StreamLogger.Debug("sleep of getStopTime: %d", w.CostTime)
+		log.StreamLogger.Debug("sleep of getStopTime: %d", w.GetCostTime())
 		// 增加一个防止chan的容量达到上限的机制 at 2024-03-07
 		if len(bucketNum) < 500 {
-			bucketNum <- token + c.Correct
+			bucketNum <- token + correct
 		}
 		// magic number
-		if c.Correct > 300 {
-			c.Correct--
+		if correct > 300 {
+			correct--
 		}
-		time.Sleep(w.CostTime / 4 * 5)
+		sleepContext(ctx, w.GetCostTime()/4*5)
 	}
 	log.StreamLogger.Debug("get stop time is finished")
-	slaveWg.Wait()
+}
+
+// throttleState tells whether the tokens come from sleep or slave lag
+func throttleState(token int64, lag int64) string {
+	if token == 0 {
+		return vars.ThrottleNone
+	}
+	if lag > 0 {
+		return vars.ThrottleLag
+	}
+	return vars.ThrottleSleep
+}
+
+// sleepContext is time.Sleep which returns once ctx is done
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
 }
 
 // bucketHandle slaveLag是个非负整数、单位为秒，我们考虑sleep时间的浮动的时候，应该考虑如下几种情况
@@ -179,24 +403,25 @@ func getStopTime(sl *lag_checker.SlaveChecker, bucketNum chan int64, c *conf.Con
 //
 // 为了避免逻辑混乱，使用者在用了sleep参数后，会进行(c.sleep-1, c.sleep]的sleep时间
 func bucketHandle(lag int64, c *conf.Config) int64 {
-	x := c.Sleep * 1000
-	if lag == 0 && c.Sleep > 0 {
+	sleep := c.GetSleep()
+	x := sleep * 1000
+	if lag == 0 && sleep > 0 {
 		return rand.Int63n(x-(x-1000)) + (x - 1000)
-	} else if lag == 0 && c.Sleep == 0 {
+	} else if lag == 0 && sleep == 0 {
 		return 0
 	} else {
 		if c.NoConsiderLag {
-			if lag <= c.Sleep {
+			if lag <= sleep {
 				return lag * 1000
 			} else {
 				return x
 			}
 		} else {
-			if lag <= c.Sleep || lag+60 <= c.Sleep {
+			if lag <= sleep || lag+60 <= sleep {
 				return lag * 1000
-			} else { // slaveLag > c.Sleep && slaveLag-c.Sleep > 60*n
-				plus := (lag - c.Sleep) / 60
-				return (c.Sleep + plus) * 1000
+			} else { // slaveLag > sleep && slaveLag-sleep > 60*n
+				plus := (lag - sleep) / 60
+				return (sleep + plus) * 1000
 			}
 		}
 	}
@@ -206,8 +431,8 @@ func bucketHandle(lag int64, c *conf.Config) int64 {
 // 如果卡死一个时间可能会很慢
 func bucketErrHandle(c *conf.Config) int64 {
 	var token int64
-	if c.Sleep != 0 {
-		x := c.Sleep * 1000
+	if sleep := c.GetSleep(); sleep != 0 {
+		x := sleep * 1000
 		token = rand.Int63n(x-(x-1000)) + (x - 1000)
 	} else {
 		token = 0
@@ -221,6 +446,7 @@ func Close(sl *lag_checker.SlaveChecker, w *mysql.Writer, bucketNum chan int64)
 			_ = slave.MysqlClient.Close()
 		}
 	}
+	w.CloseArchiver()
 	w.MysqlClient.Close()
 	close(w.ProducerQueue)
 	close(bucketNum)
@@ -229,7 +455,12 @@ func Close(sl *lag_checker.SlaveChecker, w *mysql.Writer, bucketNum chan int64)
 // --------PrintProgress----------
 
 // PrintProgress print all running tasks progress every interval
-func PrintProgress(config *conf.Config, writer *mysql.Writer, interval time.Duration, ctx context.Context, doneChan chan struct{}) {
+func PrintProgress(config *conf.Config, writer *mysql.Writer, est *estimator, interval time.Duration, ctx context.Context, doneChan chan struct{}) {
+	if format := progressFormat(config.ProgressFormat, os.Stdout); format != vars.ProgressFormatTUI {
+		printProgressLines(os.Stdout, format, config, writer, est, interval, ctx, doneChan)
+		return
+	}
+
 	start := time.Now()
 	print("\033[2J\033[H") // clear screen and move the cursor to the top-left corner of the screen
 	// clear screen
@@ -250,8 +481,8 @@ func PrintProgress(config *conf.Config, writer *mysql.Writer, interval time.Dura
 	fmt.Printf("%s.%s\n", writer.Database, writer.Table)
 	// verbose info
 	fmt.Println("=============================================")
-	color.Cyan("%-23s%-10s%-10s\n", "Time", "Elapsed", "RowAffects")
-	fmt.Printf("%-23s%-10s%-10s\n", "----", "-------", "----------")
+	color.Cyan("%-23s%-10s%-12s%-10s%-12s%-10s\n", "Time", "Elapsed", "RowAffects", "Percent", "Rows/s", "ETA")
+	fmt.Printf("%-23s%-10s%-12s%-10s%-12s%-10s\n", "----", "-------", "----------", "-------", "------", "---")
 
 	for {
 		elapsedTime := time.Now().Sub(start)
@@ -260,14 +491,18 @@ func PrintProgress(config *conf.Config, writer *mysql.Writer, interval time.Dura
 		case <-ctx.Done():
 			// return when all tasks Done
 			color.Green("Total Processed Rows: %d, speed: %.2f rows/s, spend Time: %s\n",
-				writer.RowAffects, float64(writer.RowAffects)/elapsedTime.Seconds(), time.Duration(e).String())
+				writer.GetRowAffects(), float64(writer.GetRowAffects())/elapsedTime.Seconds(), time.Duration(e).String())
 			fmt.Println("exiting...")
 			doneChan <- struct{}{}
 			return
 		default:
+			estimate := est.estimate(writer, time.Now())
 			fmt.Printf("%-23s", time.Now().Format("2006-01-02 15:04:05"))
 			fmt.Printf("%-10s", time.Duration(e).String())
-			fmt.Printf("%-10d\n", writer.RowAffects)
+			fmt.Printf("%-12d", writer.GetRowAffects())
+			fmt.Printf("%-10s", estimate.percentString())
+			fmt.Printf("%-12.2f", estimate.RowRate)
+			fmt.Printf("%-10s\n", estimate.etaString())
 			time.Sleep(interval)
 		}
 	}
@@ -1,6 +1,7 @@
 package task
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"testing"
@@ -19,7 +20,7 @@ func TestRunTask(t *testing.T) {
 		t.Fatal(err)
 	}
 	config.PreCheck()
-	err = RunTask(config)
+	err = RunTask(context.Background(), config)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,136 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/log"
+	"go-oak-chunk/v2/vars"
+)
+
+// throttleCheckTimeout is the timeout of throttle_query and throttle_http
+const throttleCheckTimeout = 5 * time.Second
+
+// throttler is checked in background, new txns wait while it returns a throttle state
+type throttler interface {
+	throttled() string
+}
+
+// firstThrottled returns the state of the first throttler asking to throttle
+func firstThrottled(throttlers []throttler) string {
+	for _, t := range throttlers {
+		if state := t.throttled(); state != "" {
+			return state
+		}
+	}
+	return ""
+}
+
+// customThrottler checks throttle_query, throttle_flag_file and throttle_http every second as gh-ost.
+// A failed check throttles too, so that a broken kill switch doesn't let the job run.
+type customThrottler struct {
+	client   *sql.DB
+	query    string
+	flagFile string
+	url      string
+	http     *http.Client
+
+	mu    sync.Mutex
+	state string
+}
+
+// newCustomThrottler returns nil if none of them is set
+func newCustomThrottler(client *sql.DB, c *conf.Config) *customThrottler {
+	if c.ThrottleQuery == "" && c.ThrottleFlagFile == "" && c.ThrottleHTTP == "" {
+		return nil
+	}
+	return &customThrottler{
+		client:   client,
+		query:    c.ThrottleQuery,
+		flagFile: c.ThrottleFlagFile,
+		url:      c.ThrottleHTTP,
+		http:     &http.Client{Timeout: throttleCheckTimeout},
+	}
+}
+
+// run checks until ctx is done or finished returns true
+func (t *customThrottler) run(ctx context.Context, finished func() bool) {
+	for !finished() && ctx.Err() == nil {
+		t.check(ctx)
+		sleepContext(ctx, time.Second)
+	}
+	log.StreamLogger.Debug("check custom throttle is finished")
+}
+
+func (t *customThrottler) check(ctx context.Context) {
+	state := ""
+	switch {
+	case t.flagFile != "" && t.flagFileExists():
+		state = vars.ThrottleFlagFile
+	case t.query != "" && t.queryThrottled(ctx):
+		state = vars.ThrottleQuery
+	case t.url != "" && t.httpThrottled(ctx):
+		state = vars.ThrottleHTTP
+	}
+	if state != "" {
+		log.StreamLogger.Debug("Throttled by %s", state)
+	}
+
+	t.mu.Lock()
+	t.state = state
+	t.mu.Unlock()
+}
+
+func (t *customThrottler) throttled() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+// flagFileExists returns true if the file exists or it can't be checked
+func (t *customThrottler) flagFileExists() bool {
+	_, err := os.Stat(t.flagFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.StreamLogger.Error("check throttle_flag_file got err: %v", err)
+	}
+	return !errors.Is(err, os.ErrNotExist)
+}
+
+// queryThrottled returns true if the first column of the first row is a non-zero number, NULL and empty set are 0
+func (t *customThrottler) queryThrottled(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, throttleCheckTimeout)
+	defer cancel()
+
+	var value sql.NullFloat64
+	err := t.client.QueryRowContext(ctx, t.query).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		log.StreamLogger.Error("throttle_query got err: %v", err)
+		return true
+	}
+	return value.Valid && value.Float64 != 0
+}
+
+// httpThrottled returns true unless GET of the url returns 200
+func (t *customThrottler) httpThrottled(ctx context.Context) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
+	if err != nil {
+		log.StreamLogger.Error("throttle_http got err: %v", err)
+		return true
+	}
+	resp, err := t.http.Do(req)
+	if err != nil {
+		log.StreamLogger.Error("throttle_http got err: %v", err)
+		return true
+	}
+	resp.Body.Close()
+	return resp.StatusCode != http.StatusOK
+}
@@ -0,0 +1,55 @@
+package task
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/vars"
+)
+
+func TestCustomThrottler(t *testing.T) {
+	if c := newCustomThrottler(nil, &conf.Config{}); c != nil {
+		t.Fatal("custom throttler without any check should be nil")
+	}
+
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	flagFile := filepath.Join(t.TempDir(), "throttle.flag")
+	c := newCustomThrottler(nil, &conf.Config{ThrottleFlagFile: flagFile, ThrottleHTTP: srv.URL})
+	ctx := context.Background()
+
+	c.check(ctx)
+	if s := c.throttled(); s != "" {
+		t.Fatalf("got throttle state %q", s)
+	}
+
+	status = http.StatusServiceUnavailable
+	c.check(ctx)
+	if s := firstThrottled([]throttler{c}); s != vars.ThrottleHTTP {
+		t.Fatalf("got throttle state %q, expected %q", s, vars.ThrottleHTTP)
+	}
+
+	if err := os.WriteFile(flagFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c.check(ctx)
+	if s := c.throttled(); s != vars.ThrottleFlagFile {
+		t.Fatalf("got throttle state %q, expected %q", s, vars.ThrottleFlagFile)
+	}
+
+	os.Remove(flagFile)
+	status = http.StatusOK
+	c.check(ctx)
+	if s := c.throttled(); s != "" {
+		t.Fatalf("got throttle state %q after flag file is removed", s)
+	}
+}
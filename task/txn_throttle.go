@@ -0,0 +1,103 @@
+package task
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/ratelimit"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/mysql"
+)
+
+// txnThrottle throttles the txns which aren't run by Write: the txns replayed by undo and the chunks rerun by verify.
+// getStopTime sends the tokens of sleep and slave lag as it does for Write, and every txn waits by WaitTxn of writer,
+// so pause, windows, max_load, critical_load and custom throttles work the same.
+type txnThrottle struct {
+	w         *mysql.Writer
+	ctx       context.Context
+	cancel    context.CancelFunc
+	bucket    *ratelimit.Bucket
+	bucketNum chan int64
+	finished  atomic.Bool
+	wg        sync.WaitGroup
+
+	mu sync.Mutex
+	// err is the error of critical load
+	err error
+}
+
+// startTxnThrottle checks critical_load before the first txn, and starts the checkers of the throttle until close
+func startTxnThrottle(ctx context.Context, c *conf.Config, w *mysql.Writer, lc *lagChecker) (*txnThrottle, error) {
+	load := newLoadChecker(w.MysqlClient, c)
+	if load != nil {
+		if err := load.check(); err != nil {
+			return nil, err
+		}
+	}
+	custom := newCustomThrottler(w.MysqlClient, c)
+	if custom != nil {
+		custom.check(ctx)
+	}
+
+	t := &txnThrottle{
+		w:         w,
+		bucket:    ratelimit.NewBucketWithQuantum(1*time.Millisecond, 1, 1),
+		bucketNum: make(chan int64, 1000),
+	}
+	t.ctx, t.cancel = context.WithCancel(ctx)
+	finished := t.finished.Load
+
+	var throttlers []throttler
+	if load != nil {
+		throttlers = append(throttlers, load)
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			if err := load.run(t.ctx, finished); err != nil {
+				t.mu.Lock()
+				t.err = err
+				t.mu.Unlock()
+				// the txn waiting for tokens is aborted
+				t.cancel()
+			}
+		}()
+	}
+	if custom != nil {
+		throttlers = append(throttlers, custom)
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			custom.run(t.ctx, finished)
+		}()
+	}
+
+	// getStopTime checks slave lag by itself unless the checker is running for parallel jobs
+	lc = lc.standalone()
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		getStopTime(t.ctx, lc, throttlers, t.bucketNum, c, w, finished)
+	}()
+	return t, nil
+}
+
+// wait waits before the next txn, it returns the error of critical load or ctx
+func (t *txnThrottle) wait() error {
+	err := t.w.WaitTxn(t.ctx, t.bucket, t.bucketNum)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return t.err
+	}
+	return err
+}
+
+// close stops the checkers of the throttle
+func (t *txnThrottle) close() {
+	t.finished.Store(true)
+	t.cancel()
+	t.wg.Wait()
+}
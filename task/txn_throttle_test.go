@@ -0,0 +1,47 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/mysql"
+	"go-oak-chunk/v2/vars"
+)
+
+func TestTxnThrottle(t *testing.T) {
+	c := &conf.Config{TxnSize: 100}
+	w, err := mysql.NewReplayWriter(nil, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	throttle, err := startTxnThrottle(context.Background(), c, w, &lagChecker{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = throttle.wait(); err != nil {
+		t.Fatal(err)
+	}
+	throttle.close()
+
+	// paused txn waits until it's resumed or ctx is done
+	w.Pause()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	throttle, err = startTxnThrottle(ctx, c, w, &lagChecker{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer throttle.close()
+	// tokens are sent by getStopTime in background
+	time.Sleep(50 * time.Millisecond)
+	if err = throttle.wait(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("paused txn got err %v", err)
+	}
+	if state := w.Throttle(); state != vars.ThrottlePaused {
+		t.Fatalf("got throttle %q of paused txn", state)
+	}
+}
@@ -0,0 +1,139 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fatih/color"
+
+	"go-oak-chunk/v2/archive"
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/log"
+	"go-oak-chunk/v2/mysql"
+	"go-oak-chunk/v2/task/lag_checker"
+	"go-oak-chunk/v2/vars"
+)
+
+// RunUndo replays the undo log written by `run --undo-file`, from the last chunk to the first one.
+// Chunks are grouped into txns by txn_size, and every txn is throttled by the same getStopTime and WaitTxn as the txns
+// of RunTask, so it waits for sleep, slave lag, pause, windows, max_load and custom throttles.
+// The reverse stmts are idempotent, an interrupted undo can be run again from the beginning.
+func RunUndo(ctx context.Context, config *conf.Config, path string) error {
+	for _, load := range []string{config.MaxLoad, config.CriticalLoad} {
+		if _, err := conf.ParseLoad(load); err != nil {
+			return err
+		}
+	}
+	if err := conf.CheckThrottle(config.ThrottleQuery, config.ThrottleHTTP); err != nil {
+		return err
+	}
+
+	r, err := archive.OpenUndoLog(path)
+	if err != nil {
+		return fmt.Errorf("open undo log is failed, err: %v", err)
+	}
+	defer r.Close()
+
+	client, err := mysql.NewMysqlClient(config)
+	if err != nil {
+		return fmt.Errorf("open connect is failed, err: %v", err)
+	}
+	defer client.Close()
+
+	w, err := mysql.NewReplayWriter(client, config)
+	if err != nil {
+		return err
+	}
+
+	lc := &lagChecker{}
+	if lc.sl, err = lag_checker.NewSlaveChecker(client, config); err != nil {
+		log.StreamLogger.Error("create SlaveChecker is failed, err: %v", err)
+	}
+	if lc.sl != nil {
+		defer func() {
+			for _, slave := range lc.sl.Slaves {
+				_ = slave.MysqlClient.Close()
+			}
+		}()
+	}
+
+	// abort by control socket is the same as SIGINT/SIGTERM
+	ctx, abort := context.WithCancel(ctx)
+	defer abort()
+	if config.ControlSocket != "" {
+		control, err := startControlServer(config.ControlSocket, config, w, lc.sl, &estimator{}, abort)
+		if err != nil {
+			return fmt.Errorf("start control socket is failed, err: %v", err)
+		}
+		defer control.Close()
+	}
+
+	throttle, err := startTxnThrottle(ctx, config, w, lc)
+	if err != nil {
+		return err
+	}
+	defer throttle.close()
+
+	total := r.Chunks()
+	for finished := false; !finished; {
+		if err = throttle.wait(); err != nil {
+			color.Yellow("Interrupted! %d of %d chunks are undone, run it again to undo all\n", w.GetChunks(), total)
+			return err
+		}
+
+		beginTime := time.Now()
+		tx, err := client.Begin()
+		if err != nil {
+			return err
+		}
+		// values of undo log are quoted by backslash
+		if _, err = tx.Exec(vars.BackslashEscapesSQL); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		var txnChunks int64
+		var txnRows int64
+		for txnRows < w.GetTxnSize() || txnChunks == 0 {
+			chunk, err := r.Next()
+			if err == io.EOF {
+				finished = true
+				break
+			}
+			if err == nil {
+				err = execUndoChunk(tx, chunk)
+			}
+			if err != nil {
+				_ = tx.Rollback()
+				return fmt.Errorf("undo chunk %d of %d is failed, err: %v", w.GetChunks()+txnChunks+1, total, err)
+			}
+			txnChunks++
+			txnRows += chunk.Rows
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		w.CommitReplay(txnChunks, txnRows, time.Since(beginTime))
+
+		if config.PrintProgress {
+			fmt.Printf("%s [undo] chunks=%d/%d rows=%d throttle=%s elapsed=%s\n", time.Now().Format("2006-01-02 15:04:05"),
+				w.GetChunks(), total, w.GetRowAffects(), w.Throttle(), time.Since(w.StartTime).Truncate(time.Second))
+		}
+	}
+	w.IsFinished = true
+
+	color.Green("Undo is finished, chunks: %d, rows: %d, spend Time: %s\n", w.GetChunks(), w.GetRowAffects(), time.Since(w.StartTime).Truncate(time.Second))
+	return nil
+}
+
+func execUndoChunk(tx *sql.Tx, chunk *archive.UndoChunk) error {
+	for _, stmt := range chunk.Stmts {
+		log.StreamLogger.Debug("undoSql: %s", stmt)
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
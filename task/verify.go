@@ -0,0 +1,131 @@
+package task
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fatih/color"
+
+	"go-oak-chunk/v2/conf"
+	"go-oak-chunk/v2/log"
+	"go-oak-chunk/v2/mysql"
+)
+
+// maxPrintRanges is how many residual ranges are printed, all of them are in the report
+const maxPrintRanges = 20
+
+// VerifyResult is the rows left after the job, which are usually inserted or changed while it's running
+type VerifyResult struct {
+	Rows   int64            `json:"residual_rows"`
+	Ranges []*ResidualRange `json:"residual_ranges"`
+	// rows affected by rerun, and the rows still left after it
+	Rerun          bool  `json:"rerun"`
+	RerunAffects   int64 `json:"rerun_row_affects"`
+	RowsAfterRerun int64 `json:"residual_rows_after_rerun"`
+}
+
+// ResidualRange is a chunk of residual rows, Start and End are nil if the job isn't chunked
+type ResidualRange struct {
+	Start []*mysql.KeyValue `json:"start"`
+	End   []*mysql.KeyValue `json:"end"`
+	Rows  int64             `json:"rows"`
+}
+
+// verify walks the table again by chunks after the job, and reports the rows still matching the where clause of
+// delete, or still different from SET of update. The residual chunks are run again if VerifyRerun, they are throttled
+// as the txns of Write.
+func verify(ctx context.Context, c *conf.Config, w *mysql.Writer, lc *lagChecker) (*VerifyResult, error) {
+	p := mysql.NewVerifyProcedure(w)
+	result := &VerifyResult{Ranges: make([]*ResidualRange, 0)}
+	chunks, err := residualChunks(ctx, p, w, result)
+	if err != nil {
+		return result, fmt.Errorf("verify is failed, err: %v", err)
+	}
+	printResidual(result)
+	if !c.VerifyRerun || result.Rows == 0 || w.ChunkSize == 0 {
+		return result, nil
+	}
+
+	throttle, err := startTxnThrottle(ctx, c, w, lc)
+	if err != nil {
+		return result, err
+	}
+	defer throttle.close()
+
+	result.Rerun = true
+	for _, pr := range chunks {
+		if err = throttle.wait(); err != nil {
+			break
+		}
+		affects, errRerun := w.RerunChunk(pr)
+		if errRerun != nil {
+			err = fmt.Errorf("rerun residual rows is failed, err: %v", errRerun)
+			break
+		}
+		result.RerunAffects += affects
+	}
+	// the chunks committed before an error are saved too
+	if errSave := w.FinishRerun(); errSave != nil {
+		log.StreamLogger.Error("save checkpoint got err: %v", errSave)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	after := &VerifyResult{}
+	if _, err = residualChunks(ctx, p, w, after); err != nil {
+		return result, fmt.Errorf("verify after rerun is failed, err: %v", err)
+	}
+	result.RowsAfterRerun = after.Rows
+	color.Cyan("Rerun affected %d rows, %d residual rows are left\n", result.RerunAffects, result.RowsAfterRerun)
+	return result, nil
+}
+
+// residualChunks fills result with the chunks of residual rows and returns them
+func residualChunks(ctx context.Context, p *mysql.Procedure, w *mysql.Writer, result *VerifyResult) ([]*mysql.Producer, error) {
+	// the stmt isn't chunked, only count the rows
+	if w.ChunkSize == 0 {
+		count, err := p.CountRows(ctx)
+		if err == nil && count > 0 {
+			result.Rows = count
+			result.Ranges = append(result.Ranges, &ResidualRange{Rows: count})
+		}
+		return nil, err
+	}
+
+	n := len(w.UniqueKeyColumns())
+	chunks := make([]*mysql.Producer, 0)
+	err := p.Walk(ctx, func(pr *mysql.Producer) {
+		chunks = append(chunks, pr)
+		result.Rows += pr.Rows
+		if len(pr.CurrentKeyValues) < n {
+			return
+		}
+		result.Ranges = append(result.Ranges, &ResidualRange{
+			Start: pr.CurrentKeyValues[:n],
+			End:   pr.CurrentKeyValues[len(pr.CurrentKeyValues)-n:],
+			Rows:  pr.Rows,
+		})
+	})
+	return chunks, err
+}
+
+func printResidual(result *VerifyResult) {
+	if result.Rows == 0 {
+		color.Green("Verify passed, no residual rows\n")
+		return
+	}
+
+	color.Yellow("Verify found %d residual rows in %d ranges\n", result.Rows, len(result.Ranges))
+	for i, r := range result.Ranges {
+		if i == maxPrintRanges {
+			fmt.Printf("  ... and %d more ranges\n", len(result.Ranges)-maxPrintRanges)
+			break
+		}
+		if r.Start == nil {
+			fmt.Printf("  %d rows\n", r.Rows)
+			continue
+		}
+		fmt.Printf("  %s ~ %s: %d rows\n", mysql.KeyValuesString(r.Start), mysql.KeyValuesString(r.End), r.Rows)
+	}
+}
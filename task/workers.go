@@ -0,0 +1,35 @@
+package task
+
+import (
+	"github.com/fatih/color"
+
+	"go-oak-chunk/v2/mysql"
+)
+
+// newWorkers splits the key range of w into at most n workers, w runs alone if the range can't be split
+func newWorkers(w *mysql.Writer, n int) ([]*mysql.Writer, error) {
+	conds, err := w.SplitKeyRange(n)
+	if err != nil {
+		return nil, err
+	}
+	if len(conds) == 0 {
+		return []*mysql.Writer{w}, nil
+	}
+
+	workers := make([]*mysql.Writer, 0, len(conds))
+	for i, cond := range conds {
+		color.Cyan("[Worker %d/%d]: %s\n", i+1, len(conds), cond)
+		workers = append(workers, w.NewWorker(cond))
+	}
+	return workers, nil
+}
+
+// workersFinished returns true when all workers finished their ranges
+func workersFinished(workers []*mysql.Writer) bool {
+	for _, w := range workers {
+		if !w.IsFinished {
+			return false
+		}
+	}
+	return true
+}
@@ -61,3 +61,53 @@ func GetMultipleColumnsEquality(tableName string, columnNames []string, columnVa
 func GetValueComparison(tableName string, columnName string, columnValue int64, comparisonSign string) string {
 	return fmt.Sprintf("(%s %s %d)", tableName+"."+columnName, comparisonSign, columnValue)
 }
+
+// BindArgs replaces every '?' placeholder outside of quoted strings with its arg, so that a stmt can be printed
+// the way it will be executed. noBackslashEscapes is the NO_BACKSLASH_ESCAPES sql_mode of the session which runs it.
+// e.g. 'id > ? AND c = ?', [7, "a'b"]
+// results with id > 7 AND c = 'a\'b', the quote is doubled instead if noBackslashEscapes
+func BindArgs(query string, args []any, noBackslashEscapes bool) string {
+	var (
+		buf   strings.Builder
+		quote rune
+		n     int
+	)
+	for i, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote && (i == 0 || noBackslashEscapes || query[i-1] != '\\') {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '?' && n < len(args):
+			buf.WriteString(QuoteValue(args[n], noBackslashEscapes))
+			n++
+			continue
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// QuoteValue returns the sql literal of a value. Backslash is an ordinary char if noBackslashEscapes,
+// only quotes are escaped by doubling them.
+func QuoteValue(value any, noBackslashEscapes bool) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return Quota + escapeString(v, noBackslashEscapes) + Quota
+	case []byte:
+		return Quota + escapeString(string(v), noBackslashEscapes) + Quota
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func escapeString(s string, noBackslashEscapes bool) string {
+	if noBackslashEscapes {
+		return strings.ReplaceAll(s, Quota, Quota+Quota)
+	}
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`, "\x00", `\0`, "\x1a", `\Z`).Replace(s)
+}
@@ -0,0 +1,20 @@
+package utils
+
+import "testing"
+
+func TestBindArgs(t *testing.T) {
+	query := "DELETE FROM `t` WHERE (`c` = 'why?') AND (`id` >= ? AND `id` <= ?) AND `pad` = ?"
+	got := BindArgs(query, []any{int64(1), uint64(20), "a'b"}, false)
+	want := "DELETE FROM `t` WHERE (`c` = 'why?') AND (`id` >= 1 AND `id` <= 20) AND `pad` = 'a\\'b'"
+	if got != want {
+		t.Fatalf("BindArgs got %s, want %s", got, want)
+	}
+
+	// backslash is an ordinary char in NO_BACKSLASH_ESCAPES sql_mode, it doesn't escape the quote after it
+	query = "DELETE FROM `t` WHERE `c` = 'a\\' AND `id` >= ? AND `pad` = ?"
+	got = BindArgs(query, []any{int64(1), "a\\'b"}, true)
+	want = "DELETE FROM `t` WHERE `c` = 'a\\' AND `id` >= 1 AND `pad` = 'a\\''b'"
+	if got != want {
+		t.Fatalf("BindArgs got %s, want %s", got, want)
+	}
+}
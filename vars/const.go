@@ -15,6 +15,69 @@ const (
 	UnlockTableSQL = "UNLOCK TABLES"
 
 	FirstSQL = "select /*!40001 SQL_NO_CACHE */ %s from %s where %s"
+
+	ExplainSQL = "EXPLAIN %s"
+
+	CountSQL = "select count(*) from %s where %s"
+
+	KeyRangeSQL = "select min(`%s`), max(`%s`) from `%s`.`%s`"
+
+	KeyFirstSQL = "select %s from %s where %s ORDER BY %s LIMIT 1"
+
+	KeyStepSQL = "select %s from %s where %s AND %s > ? ORDER BY %s LIMIT %d, 1"
+
+	GlobalStatusSQL = "SHOW GLOBAL STATUS WHERE Variable_name IN (%s)"
+
+	SqlModeSQL = "select @@SESSION.sql_mode"
+
+	// BackslashEscapesSQL removes NO_BACKSLASH_ESCAPES from sql_mode of session, for the stmts with values quoted by backslash
+	BackslashEscapesSQL = "SET SESSION sql_mode = TRIM(BOTH ',' FROM REPLACE(CONCAT(',', @@SESSION.sql_mode, ','), ',NO_BACKSLASH_ESCAPES,', ','))"
+
+	ArchiveSelectSQL = "select %s from `%s` where "
+
+	UndoSelectSQL = "select %s from `%s` where "
+
+	CreateJobTableSQL = "CREATE TABLE IF NOT EXISTS %s.`_goc_jobs` (" +
+		"`job_id` varchar(64) NOT NULL," +
+		"`db_name` varchar(64) NOT NULL DEFAULT ''," +
+		"`table_name` varchar(64) NOT NULL DEFAULT ''," +
+		"`sql_type` varchar(16) NOT NULL DEFAULT ''," +
+		"`execute_sql` text NOT NULL," +
+		"`unique_key` varchar(1024) NOT NULL DEFAULT ''," +
+		"`last_key` text NOT NULL," +
+		"`row_affects` bigint NOT NULL DEFAULT 0," +
+		"`status` varchar(16) NOT NULL DEFAULT ''," +
+		"`host` varchar(255) NOT NULL DEFAULT ''," +
+		"`config` text NOT NULL," +
+		"`started_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP," +
+		"`heartbeat_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP," +
+		"PRIMARY KEY (`job_id`)," +
+		"KEY `idx_status` (`status`)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+	SaveJobSQL = `
+        INSERT INTO %s.` + "`_goc_jobs`" + `
+            (job_id, db_name, table_name, sql_type, execute_sql, unique_key, last_key, row_affects, status, host, config, heartbeat_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW())
+        ON DUPLICATE KEY UPDATE
+            db_name = VALUES(db_name), table_name = VALUES(table_name), sql_type = VALUES(sql_type),
+            execute_sql = VALUES(execute_sql), unique_key = VALUES(unique_key), config = VALUES(config),
+            last_key = VALUES(last_key), row_affects = VALUES(row_affects), status = VALUES(status),
+            host = VALUES(host), heartbeat_at = NOW()`
+
+	JobStatusSQL = "SELECT status FROM %s.`_goc_jobs` WHERE job_id = ?"
+
+	LoadJobSQL = `
+        SELECT db_name, table_name, sql_type, execute_sql, unique_key, last_key, row_affects, status, config, UNIX_TIMESTAMP(heartbeat_at)
+        FROM %s.` + "`_goc_jobs`" + `
+        WHERE job_id = ?`
+)
+
+// explain check policy
+const (
+	ExplainCheckWarn  = "warn"
+	ExplainCheckAbort = "abort"
+	ExplainCheckOff   = "off"
 )
 
 const (
@@ -40,4 +103,49 @@ const (
 
 const LagThreshold int64 = -1
 
+// job status
+const (
+	JobRunning     = "running"
+	JobFinished    = "finished"
+	JobInterrupted = "interrupted"
+	// JobFailed is only shown in the report, failed job keeps the status of its last commit in checkpoint
+	JobFailed = "failed"
+	// JobSkipped is a job of jobs file which isn't started because a previous job fails
+	JobSkipped = "skipped"
+)
+
+// throttle state
+const (
+	ThrottleNone   = "none"
+	ThrottleSleep  = "sleep"
+	ThrottleLag    = "lag"
+	ThrottleMaxLag = "max-lag"
+	ThrottlePaused = "paused"
+	ThrottleWindow = "window"
+	// ThrottleMaxLoad is the global status of source over max_load
+	ThrottleMaxLoad = "max-load"
+	// ThrottleQuery, ThrottleFlagFile and ThrottleHTTP are the custom throttles of throttle_query,
+	// throttle_flag_file and throttle_http
+	ThrottleQuery    = "throttle-query"
+	ThrottleFlagFile = "throttle-flag-file"
+	ThrottleHTTP     = "throttle-http"
+)
+
+// archive file format
+const (
+	ArchiveFormatCSV  = "csv"
+	ArchiveFormatJSON = "json"
+	ArchiveFormatSQL  = "sql"
+)
+
+// progress format, tui is used only when stdout is a terminal if it's not specified
+const (
+	ProgressFormatPlain = "plain"
+	ProgressFormatJSON  = "json"
+	ProgressFormatTUI   = "tui"
+)
+
+// ExitInterrupted is the exit code when job is stopped by SIGINT/SIGTERM
+const ExitInterrupted = 130
+
 const Billion = 1000000000